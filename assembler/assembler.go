@@ -0,0 +1,340 @@
+// Package assembler turns the text Instructions.String and the disassembler print back into bytecode,
+// for tests that need exact instructions, or instructions the compiler does not emit.
+package assembler
+
+import (
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/object"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Assemble parses a program made of sections, lines before the first section belong to main:
+//
+//	== constants ==
+//	0: 10
+//	1: "ten"
+//	2: 1.5
+//
+//	== main ==
+//	0000 OpConstant 0
+//	loop:
+//	OpJump loop          ; a label can stand for any operand
+//
+//	== constant 3: fn add, 2 parameters, 2 locals ==
+//	OpGetLocal 0
+//	OpGetLocal 1
+//	OpAdd
+//	OpReturnValue
+//
+// Everything after a ; is a comment. The offset in front of an instruction is optional, when present it must be right.
+// Every index of the constant pool must be defined, by the constants section or by a function section.
+func Assemble(source string) (*compiler.ByteCode, error) {
+	sections, err := split(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bytecode := &compiler.ByteCode{}
+	constants := make(map[int]object.Object)
+	numberOfConstants := 0
+	hasMain := false
+
+	for _, section := range sections {
+		switch section.kind {
+		case mainSection:
+			if hasMain {
+				return nil, fmt.Errorf("line %d: main is defined twice", section.line)
+			}
+
+			hasMain = true
+			bytecode.Instructions, err = assembleFunction(section, bytecode)
+		case constantsSection:
+			err = assembleConstants(section, constants)
+		case functionSection:
+			section.fn.Instructions, err = assembleFunction(section, bytecode)
+
+			if err == nil {
+				err = define(constants, section.index, section.fn, section.line)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for index := range constants {
+		numberOfConstants = max(numberOfConstants, index+1)
+	}
+
+	bytecode.Constants = make([]object.Object, numberOfConstants)
+
+	for index := range bytecode.Constants {
+		constant, ok := constants[index]
+
+		if !ok {
+			return nil, fmt.Errorf("constant %d is not defined", index)
+		}
+
+		bytecode.Constants[index] = constant
+	}
+
+	return bytecode, nil
+}
+
+type sectionKind int
+
+const (
+	mainSection sectionKind = iota
+	constantsSection
+	functionSection
+)
+
+type line struct {
+	number int
+	text   string
+}
+
+type section struct {
+	kind  sectionKind
+	line  int // of the header
+	index int // in the constant pool, for a function
+	fn    *object.CompiledFunction
+	lines []line
+}
+
+var functionHeader = regexp.MustCompile(`^constant (\d+): fn (\S+), (\d+) parameters?, (\d+) locals?$`)
+var labelLine = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):$`)
+var constantLine = regexp.MustCompile(`^(\d+):\s*(.+)$`)
+
+// split cuts source into sections, without comments and blank lines
+func split(source string) ([]*section, error) {
+	current := &section{kind: mainSection, line: 1}
+	sections := []*section{current}
+
+	for index, text := range strings.Split(source, "\n") {
+		number := index + 1
+		text = strings.TrimSpace(stripComment(text))
+
+		if text == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(text, "==") || !strings.HasSuffix(text, "==") || len(text) < 4 {
+			current.lines = append(current.lines, line{number: number, text: text})
+			continue
+		}
+
+		header := strings.TrimSpace(text[2 : len(text)-2])
+		current = &section{line: number}
+
+		switch {
+		case header == "main":
+			current.kind = mainSection
+		case header == "constants":
+			current.kind = constantsSection
+		case functionHeader.MatchString(header):
+			matches := functionHeader.FindStringSubmatch(header)
+
+			current.kind = functionSection
+			current.index, _ = strconv.Atoi(matches[1])
+			current.fn = &object.CompiledFunction{}
+
+			if matches[2] != "<anonymous>" {
+				current.fn.Name = matches[2]
+			}
+
+			current.fn.NumberOfParameters, _ = strconv.Atoi(matches[3])
+			current.fn.NumberOfLocals, _ = strconv.Atoi(matches[4])
+		default:
+			return nil, fmt.Errorf("line %d: unknown section %q", number, header)
+		}
+
+		sections = append(sections, current)
+	}
+
+	// the implicit main section before any header, when nothing was written in it
+	if len(sections[0].lines) == 0 {
+		sections = sections[1:]
+	}
+
+	return sections, nil
+}
+
+// stripComment drops everything after a ; that is not inside a string
+func stripComment(text string) string {
+	inString := false
+
+	for index := 0; index < len(text); index++ {
+		switch text[index] {
+		case '\\':
+			if inString {
+				index++
+			}
+		case '"':
+			inString = !inString
+		case ';':
+			if !inString {
+				return text[:index]
+			}
+		}
+	}
+
+	return text
+}
+
+func define(constants map[int]object.Object, index int, constant object.Object, lineNumber int) error {
+	// OpConstant and OpClosure have a 2-byte operand, the pool cannot be larger
+	if index > math.MaxUint16 {
+		return fmt.Errorf("line %d: constant %d is out of range, the pool holds at most %d", lineNumber, index,
+			math.MaxUint16+1)
+	}
+
+	if _, ok := constants[index]; ok {
+		return fmt.Errorf("line %d: constant %d is defined twice", lineNumber, index)
+	}
+
+	constants[index] = constant
+
+	return nil
+}
+
+func assembleConstants(section *section, constants map[int]object.Object) error {
+	for _, line := range section.lines {
+		matches := constantLine.FindStringSubmatch(line.text)
+
+		if matches == nil {
+			return fmt.Errorf("line %d: expected a constant like `0: 10`, got %q", line.number, line.text)
+		}
+
+		index, _ := strconv.Atoi(matches[1])
+		constant, err := parseConstant(matches[2])
+
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line.number, err)
+		}
+
+		err = define(constants, index, constant, line.number)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseConstant(text string) (object.Object, error) {
+	if strings.HasPrefix(text, `"`) {
+		value, err := strconv.Unquote(text)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+
+		return &object.String{Value: value}, nil
+	}
+
+	if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return &object.Integer{Value: integer}, nil
+	}
+
+	if float, err := strconv.ParseFloat(text, 64); err == nil {
+		return &object.Float{Value: float}, nil
+	}
+
+	return nil, fmt.Errorf("invalid constant %s, want an integer, a float or a string", text)
+}
+
+type instruction struct {
+	line       line
+	op         code.Opcode
+	definition *code.Definition
+	operands   []string
+}
+
+// assembleFunction lays out the instructions of a section to know where its labels are, then encodes them
+func assembleFunction(section *section, bytecode *compiler.ByteCode) (code.Instructions, error) {
+	labels := make(map[string]int)
+	var instructions []instruction
+	offset := 0
+
+	for _, line := range section.lines {
+		if matches := labelLine.FindStringSubmatch(line.text); matches != nil {
+			if _, ok := labels[matches[1]]; ok {
+				return nil, fmt.Errorf("line %d: label %s is defined twice", line.number, matches[1])
+			}
+
+			labels[matches[1]] = offset
+			continue
+		}
+
+		fields := strings.Fields(line.text)
+
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			if fields[0] != fmt.Sprintf("%04d", offset) {
+				return nil, fmt.Errorf("line %d: instruction is at offset %04d, not %s", line.number, offset, fields[0])
+			}
+
+			fields = fields[1:]
+		}
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing instruction after the offset", line.number)
+		}
+
+		op, definition, err := code.LookUpName(fields[0])
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line.number, err)
+		}
+
+		if len(fields)-1 != len(definition.OperandsWidth) {
+			return nil, fmt.Errorf("line %d: %s takes %d operands, got %d", line.number, definition.Name,
+				len(definition.OperandsWidth), len(fields)-1)
+		}
+
+		instructions = append(instructions, instruction{line: line, op: op, definition: definition, operands: fields[1:]})
+		offset += definition.Width()
+	}
+
+	assembled := code.Instructions{}
+
+	for _, ins := range instructions {
+		operands := make([]int, len(ins.operands))
+
+		for index, text := range ins.operands {
+			operand, ok := labels[text]
+
+			if !ok {
+				var err error
+				operand, err = strconv.Atoi(text)
+
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s is neither a number nor a label", ins.line.number, text)
+				}
+			}
+
+			if operand < 0 || operand >= 1<<(8*ins.definition.OperandsWidth[index]) {
+				return nil, fmt.Errorf("line %d: operand %d of %s does not fit in %d bytes", ins.line.number, operand,
+					ins.definition.Name, ins.definition.OperandsWidth[index])
+			}
+
+			operands[index] = operand
+		}
+
+		if ins.op == code.OpGetGlobal || ins.op == code.OpSetGlobal {
+			bytecode.NumberOfGlobals = max(bytecode.NumberOfGlobals, operands[0]+1)
+		}
+
+		assembled = append(assembled, code.Make(ins.op, operands...)...)
+	}
+
+	return assembled, nil
+}
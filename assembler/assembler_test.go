@@ -0,0 +1,212 @@
+package assembler
+
+import (
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/disassembler"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"strings"
+	"testing"
+)
+
+func concat(instructions ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func TestAssemble(t *testing.T) {
+	source := `
+; sums its two arguments until the first one is 0
+== constants ==
+0: 10
+1: "a ; b"
+2: -1.5
+
+== main ==
+0000 OpConstant 0
+0003 OpSetGlobal 2
+loop:
+OpGetGlobal 2          ; comment
+OpJumpNotTruthy end
+OpJump loop
+end:
+OpClosure 3 0
+OpPop
+
+== constant 3: fn add, 2 parameters, 3 locals ==
+OpGetLocal 0
+OpGetLocal 1
+OpAdd
+OpReturnValue
+`
+
+	bytecode, err := Assemble(source)
+
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+
+	expected := concat(
+		// 0000
+		code.Make(code.OpConstant, 0),
+		// 0003
+		code.Make(code.OpSetGlobal, 2),
+		// 0006
+		code.Make(code.OpGetGlobal, 2),
+		// 0009
+		code.Make(code.OpJumpNotTruthy, 15),
+		// 0012
+		code.Make(code.OpJump, 6),
+		// 0015
+		code.Make(code.OpClosure, 3, 0),
+		// 0019
+		code.Make(code.OpPop),
+	)
+
+	if bytecode.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nwant =\n%s\ngot =\n%s", expected, bytecode.Instructions)
+	}
+
+	if bytecode.NumberOfGlobals != 3 {
+		t.Errorf("wrong number of globals. want = 3, got = %d", bytecode.NumberOfGlobals)
+	}
+
+	if len(bytecode.Constants) != 4 {
+		t.Fatalf("wrong number of constants. want = 4, got = %d", len(bytecode.Constants))
+	}
+
+	for index, want := range []string{"10", "a ; b", "-1.5"} {
+		if bytecode.Constants[index].Inspect() != want {
+			t.Errorf("constant %d: want = %s, got = %s", index, want, bytecode.Constants[index].Inspect())
+		}
+	}
+
+	fn, ok := bytecode.Constants[3].(*object.CompiledFunction)
+
+	if !ok {
+		t.Fatalf("constant 3 is not a function. got = %T", bytecode.Constants[3])
+	}
+
+	expectedFn := concat(code.Make(code.OpGetLocal, 0), code.Make(code.OpGetLocal, 1), code.Make(code.OpAdd), code.Make(code.OpReturnValue))
+
+	if fn.Name != "add" || fn.NumberOfParameters != 2 || fn.NumberOfLocals != 3 || fn.Instructions.String() != expectedFn.String() {
+		t.Errorf("wrong function. got = %+v\n%s", fn, fn.Instructions)
+	}
+}
+
+// TestAssembleInstructionsString assembles what Instructions.String prints, without any section
+func TestAssembleInstructionsString(t *testing.T) {
+	instructions := concat(code.Make(code.OpTrue), code.Make(code.OpDup, 1), code.Make(code.OpPop), code.Make(code.OpPop))
+
+	bytecode, err := Assemble(instructions.String())
+
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+
+	if bytecode.Instructions.String() != instructions.String() {
+		t.Errorf("wrong instructions.\nwant =\n%s\ngot =\n%s", instructions, bytecode.Instructions)
+	}
+}
+
+// TestAssembleDisassembly reads the disassembly of a compiled program back, with its other constants in a section
+func TestAssembleDisassembly(t *testing.T) {
+	input := `let counter = fn(n) { let i = 0; while (i < n) { i += 1; if (i == 3) { break; } }; fn() { i } };
+puts(counter(10)(), "done");`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	compiled := myCompiler.ByteCode()
+
+	var source strings.Builder
+	source.WriteString("== constants ==\n")
+
+	for index, constant := range compiled.Constants {
+		switch constant := constant.(type) {
+		case *object.String:
+			fmt.Fprintf(&source, "%d: %q\n", index, constant.Value)
+		case *object.Integer:
+			fmt.Fprintf(&source, "%d: %d\n", index, constant.Value)
+		}
+	}
+
+	source.WriteString(disassembler.Disassemble(compiled))
+
+	bytecode, err := Assemble(source.String())
+
+	if err != nil {
+		t.Fatalf("assembler error: %s\n%s", err, source.String())
+	}
+
+	// names are debug info that the text only carries in comments
+	if bytecode.Instructions.String() != compiled.Instructions.String() {
+		t.Errorf("wrong main instructions.\nwant =\n%s\ngot =\n%s", compiled.Instructions, bytecode.Instructions)
+	}
+
+	if len(bytecode.Constants) != len(compiled.Constants) {
+		t.Fatalf("wrong number of constants. want = %d, got = %d", len(compiled.Constants), len(bytecode.Constants))
+	}
+
+	for index, constant := range compiled.Constants {
+		want, ok := constant.(*object.CompiledFunction)
+
+		if !ok {
+			if bytecode.Constants[index].Inspect() != constant.Inspect() {
+				t.Errorf("constant %d: want = %s, got = %s", index, constant.Inspect(), bytecode.Constants[index].Inspect())
+			}
+			continue
+		}
+
+		got, ok := bytecode.Constants[index].(*object.CompiledFunction)
+
+		if !ok || got.Name != want.Name || got.NumberOfParameters != want.NumberOfParameters ||
+			got.NumberOfLocals != want.NumberOfLocals || got.Instructions.String() != want.Instructions.String() {
+			t.Errorf("constant %d: wrong function. want = %+v, got = %+v", index, want, bytecode.Constants[index])
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tableTests := []struct {
+		source   string
+		expected string
+	}{
+		{"OpNothing", "line 1: opcode OpNothing undefined"},
+		{"OpConstant", "line 1: OpConstant takes 1 operands, got 0"},
+		{"== constants ==\n1: 2", "constant 0 is not defined"},
+		{"OpGetLocal 256", "line 1: operand 256 of OpGetLocal does not fit in 1 bytes"},
+		{"OpJump nowhere", "line 1: nowhere is neither a number nor a label"},
+		{"OpTrue\n0003 OpPop", "line 2: instruction is at offset 0001, not 0003"},
+		{"a:\na:\nOpTrue", "line 2: label a is defined twice"},
+		{"== data ==", `line 1: unknown section "data"`},
+		{"== constants ==\n0: true", "line 2: invalid constant true, want an integer, a float or a string"},
+		{"== constants ==\n0: 1\n0: 2", "line 3: constant 0 is defined twice"},
+		{"OpTrue\n== main ==\nOpPop", "line 2: main is defined twice"},
+		{"== constants ==\n65536: 1", "line 2: constant 65536 is out of range, the pool holds at most 65536"},
+		{"== constants ==\n4000000000: 1", "line 2: constant 4000000000 is out of range, the pool holds at most 65536"},
+		{"== constant 70000: fn f, 0 parameters, 0 locals ==\nOpReturn", "line 1: constant 70000 is out of range, the pool holds at most 65536"},
+	}
+
+	for _, tt := range tableTests {
+		_, err := Assemble(tt.source)
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want = %q, got = %v", tt.source, tt.expected, err)
+		}
+	}
+}
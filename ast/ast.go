@@ -12,6 +12,8 @@ const BLANK_WHITESPACE string = " "
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Span is the range of source the node was parsed from
+	Span() token.Span
 }
 
 // marker interface$
@@ -40,6 +42,17 @@ func (self *Program) TokenLiteral() string {
 	}
 }
 
+func (self *Program) Span() token.Span {
+	if len(self.Statements) == 0 {
+		return token.Span{}
+	}
+
+	first := self.Statements[0].Span()
+	last := self.Statements[len(self.Statements)-1].Span()
+
+	return token.Span{Start: first.Start, End: last.End}
+}
+
 func (self *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range self.Statements {
@@ -60,6 +73,10 @@ func (self *Identifier) TokenLiteral() string {
 	return self.Token.Literal
 }
 
+func (self *Identifier) Span() token.Span {
+	return self.Token.Span
+}
+
 func (self *Identifier) String() string {
 	return self.Value
 }
@@ -76,6 +93,10 @@ func (self *LetStatement) TokenLiteral() string {
 	return self.Token.Literal
 }
 
+func (self *LetStatement) Span() token.Span {
+	return spanUntil(self.Token.Span, self.Value)
+}
+
 func (self *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -102,6 +123,10 @@ func (self *ReturnStatement) TokenLiteral() string {
 	return self.Token.Literal
 }
 
+func (self *ReturnStatement) Span() token.Span {
+	return spanUntil(self.Token.Span, self.ReturnValue)
+}
+
 func (self *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -127,6 +152,10 @@ func (self *ExpressionStatement) TokenLiteral() string {
 	return self.Token.Literal
 }
 
+func (self *ExpressionStatement) Span() token.Span {
+	return spanUntil(self.Token.Span, self.Expression)
+}
+
 func (self *ExpressionStatement) String() string {
 	if self.Expression != nil {
 		return self.Expression.String()
@@ -144,10 +173,29 @@ func (self *IntegerLiteral) expressionNode() {}
 func (self *IntegerLiteral) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *IntegerLiteral) Span() token.Span {
+	return self.Token.Span
+}
 func (self *IntegerLiteral) String() string {
 	return self.Token.Literal
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (self *FloatLiteral) expressionNode() {}
+func (self *FloatLiteral) TokenLiteral() string {
+	return self.Token.Literal
+}
+func (self *FloatLiteral) Span() token.Span {
+	return self.Token.Span
+}
+func (self *FloatLiteral) String() string {
+	return self.Token.Literal
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -158,6 +206,9 @@ func (self *PrefixExpression) expressionNode() {}
 func (self *PrefixExpression) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *PrefixExpression) Span() token.Span {
+	return spanUntil(self.Token.Span, self.Right)
+}
 func (self *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -179,6 +230,13 @@ func (self *InfixExpression) expressionNode() {}
 func (self *InfixExpression) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *InfixExpression) Span() token.Span {
+	start := self.Token.Span
+	if self.Left != nil {
+		start = self.Left.Span()
+	}
+	return spanUntil(start, self.Right)
+}
 func (self *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -191,6 +249,38 @@ func (self *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression is `target = value`, or a compound assignment such as `target += value`.
+// It evaluates to the assigned value.
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (self *AssignExpression) expressionNode() {}
+func (self *AssignExpression) TokenLiteral() string {
+	return self.Token.Literal
+}
+func (self *AssignExpression) Span() token.Span {
+	start := self.Token.Span
+	if self.Target != nil {
+		start = self.Target.Span()
+	}
+	return spanUntil(start, self.Value)
+}
+func (self *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(self.Target.String())
+	out.WriteString(BLANK_WHITESPACE + self.Operator + BLANK_WHITESPACE)
+	out.WriteString(self.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -200,6 +290,9 @@ func (self *Boolean) expressionNode() {}
 func (self *Boolean) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *Boolean) Span() token.Span {
+	return self.Token.Span
+}
 func (self *Boolean) String() string {
 	return self.Token.Literal
 }
@@ -215,6 +308,15 @@ func (self *IfExpression) expressionNode() {}
 func (self *IfExpression) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *IfExpression) Span() token.Span {
+	if self.Alternative != nil {
+		return spanUntil(self.Token.Span, self.Alternative)
+	}
+	if self.Consequence != nil {
+		return spanUntil(self.Token.Span, self.Consequence)
+	}
+	return spanUntil(self.Token.Span, self.Condition)
+}
 func (self *IfExpression) String() string {
 
 	var out bytes.Buffer
@@ -235,12 +337,16 @@ func (self *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	EndToken   token.Token // the } token
 }
 
 func (self *BlockStatement) statementNode() {}
 func (self *BlockStatement) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *BlockStatement) Span() token.Span {
+	return spanTo(self.Token.Span, self.EndToken.Span)
+}
 func (self *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -262,6 +368,12 @@ func (self *FunctionLiteral) expressionNode() {}
 func (self *FunctionLiteral) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *FunctionLiteral) Span() token.Span {
+	if self.Body == nil {
+		return self.Token.Span
+	}
+	return spanUntil(self.Token.Span, self.Body)
+}
 func (self *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -289,12 +401,20 @@ type CallExpression struct {
 	Token     token.Token // the ( token
 	Function  Expression
 	Arguments []Expression
+	EndToken  token.Token // the ) token
 }
 
 func (self *CallExpression) expressionNode() {}
 func (self *CallExpression) TokenLiteral() string {
 	return self.Token.Literal
 }
+func (self *CallExpression) Span() token.Span {
+	start := self.Token.Span
+	if self.Function != nil {
+		start = self.Function.Span()
+	}
+	return spanTo(start, self.EndToken.Span)
+}
 func (self *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -320,14 +440,17 @@ type StringLiteral struct {
 func (self *StringLiteral) expressionNode()      {}
 func (self *StringLiteral) TokenLiteral() string { return self.Token.Literal }
 func (self *StringLiteral) String() string       { return self.Token.Literal }
+func (self *StringLiteral) Span() token.Span     { return self.Token.Span }
 
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	EndToken token.Token // the ']' token
 }
 
 func (self *ArrayLiteral) expressionNode()      {}
 func (self *ArrayLiteral) TokenLiteral() string { return self.Token.Literal }
+func (self *ArrayLiteral) Span() token.Span     { return spanTo(self.Token.Span, self.EndToken.Span) }
 func (self *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	var elements []string
@@ -344,13 +467,21 @@ func (self *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // the '[' token
-	Left  Expression
-	Index Expression
+	Token    token.Token // the '[' token
+	Left     Expression
+	Index    Expression
+	EndToken token.Token // the ']' token
 }
 
 func (self *IndexExpression) expressionNode()      {}
 func (self *IndexExpression) TokenLiteral() string { return self.Token.Literal }
+func (self *IndexExpression) Span() token.Span {
+	start := self.Token.Span
+	if self.Left != nil {
+		start = self.Left.Span()
+	}
+	return spanTo(start, self.EndToken.Span)
+}
 func (self *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -364,12 +495,14 @@ func (self *IndexExpression) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	Token    token.Token // the '{' token
+	Pairs    map[Expression]Expression
+	EndToken token.Token // the '}' token
 }
 
 func (self *HashLiteral) expressionNode()      {}
 func (self *HashLiteral) TokenLiteral() string { return self.Token.Literal }
+func (self *HashLiteral) Span() token.Span     { return spanTo(self.Token.Span, self.EndToken.Span) }
 func (self *HashLiteral) String() string {
 
 	var out bytes.Buffer
@@ -386,3 +519,94 @@ func (self *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token     token.Token // the while token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (self *WhileStatement) statementNode() {}
+func (self *WhileStatement) TokenLiteral() string {
+	return self.Token.Literal
+}
+func (self *WhileStatement) Span() token.Span {
+	if self.Body == nil {
+		return spanUntil(self.Token.Span, self.Condition)
+	}
+	return spanUntil(self.Token.Span, self.Body)
+}
+func (self *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(self.Condition.String())
+	out.WriteString(BLANK_WHITESPACE)
+	out.WriteString(self.Body.String())
+
+	return out.String()
+}
+
+type ForStatement struct {
+	Token    token.Token // the for token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (self *ForStatement) statementNode() {}
+func (self *ForStatement) TokenLiteral() string {
+	return self.Token.Literal
+}
+func (self *ForStatement) Span() token.Span {
+	if self.Body == nil {
+		return spanUntil(self.Token.Span, self.Iterable)
+	}
+	return spanUntil(self.Token.Span, self.Body)
+}
+func (self *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for")
+	out.WriteString("(" + self.Variable.String() + " in " + self.Iterable.String() + ")")
+	out.WriteString(BLANK_WHITESPACE)
+	out.WriteString(self.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the break token
+}
+
+func (self *BreakStatement) statementNode()       {}
+func (self *BreakStatement) TokenLiteral() string { return self.Token.Literal }
+func (self *BreakStatement) Span() token.Span     { return self.Token.Span }
+func (self *BreakStatement) String() string       { return self.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token // the continue token
+}
+
+func (self *ContinueStatement) statementNode()       {}
+func (self *ContinueStatement) TokenLiteral() string { return self.Token.Literal }
+func (self *ContinueStatement) Span() token.Span     { return self.Token.Span }
+func (self *ContinueStatement) String() string       { return self.Token.Literal + ";" }
+
+// spanUntil stretches start up to the end of the last node,
+// a node missing because of a parse error leaves start as is
+func spanUntil(start token.Span, last Node) token.Span {
+	if last == nil {
+		return start
+	}
+
+	return spanTo(start, last.Span())
+}
+
+func spanTo(start token.Span, end token.Span) token.Span {
+	if !end.IsValid() {
+		return start
+	}
+
+	return token.Span{Start: start.Start, End: end.End}
+}
@@ -7,12 +7,15 @@ import (
 	"github.com/Neal-C/compiler-in-go/evaluator"
 	"github.com/Neal-C/compiler-in-go/lexer"
 	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/optimizer"
 	"github.com/Neal-C/compiler-in-go/parser"
 	"github.com/Neal-C/compiler-in-go/vm"
+	"os"
 	"time"
 )
 
 var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var optimize = flag.Bool("O", false, "run the peephole optimizer over the compiled bytecode")
 var input = `
 let fibonacci = fn(x) {
 if (x == 0) {
@@ -28,8 +31,18 @@ fibonacci(x - 1) + fibonacci(x - 2);
 fibonacci(35);
 `
 
+// usage: benchmark [-engine=vm|eval] [-O] [file], the fibonacci program below when no file is given
 func main() {
 	flag.Parse()
+
+	if flag.NArg() > 0 {
+		source, err := os.ReadFile(flag.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		input = string(source)
+	}
 	var duration time.Duration
 	var result object.Object
 
@@ -46,7 +59,11 @@ func main() {
 			fmt.Printf("compiler error: %s", err)
 			return
 		}
-		myVM := vm.New(myCompiler.ByteCode())
+		bytecode := myCompiler.ByteCode()
+		if *optimize {
+			bytecode = optimizer.Optimize(bytecode)
+		}
+		myVM := vm.New(bytecode)
 		start := time.Now()
 		err = myVM.Run()
 		if err != nil {
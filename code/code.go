@@ -44,6 +44,15 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpMod
+	OpGreaterThanOrEqual
+	OpIterable
+	OpSetFree
+	OpGetLocalCell
+	OpGetFreeCell
+	OpSetIndex
+	OpDup
+	OpTailCall
 )
 
 type Definition struct {
@@ -82,6 +91,21 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}}, // 2 operands, first is 2 bytes, second 1 byte
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	// a <= b is compiled as b >= a, the same way a < b is compiled as b > a
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	// replaces the value on top of the stack with an array of what a for loop iterates over
+	OpIterable: {"OpIterable", []int{}},
+	OpSetFree:  {"OpSetFree", []int{1}},
+	// push the cell of a variable that a closure captures instead of its value, see OpClosure
+	OpGetLocalCell: {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{1}},
+	// pops the value, the index and the array or hash, then pushes the value back
+	OpSetIndex: {"OpSetIndex", []int{}},
+	// pushes a copy of the top n values, in the same order
+	OpDup: {"OpDup", []int{1}},
+	// OpCall for a call whose result is returned right away, the VM reuses the frame of the caller
+	OpTailCall: {"OpTailCall", []int{1}},
 }
 
 func LookUp(op byte) (*Definition, error) {
@@ -94,6 +118,17 @@ func LookUp(op byte) (*Definition, error) {
 	return definition, nil
 }
 
+// LookUpName finds an opcode by the name Instructions.String prints for it, "OpConstant"
+func LookUpName(name string) (Opcode, *Definition, error) {
+	for op, definition := range definitions {
+		if definition.Name == name {
+			return op, definition, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("opcode %s undefined", name)
+}
+
 // That's how you make bytecode
 
 func Make(op Opcode, operands ...int) []byte {
@@ -141,12 +176,18 @@ func (self Instructions) String() string {
 
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			index++
 			continue
 		}
 
+		if index+definition.Width() > len(self) {
+			fmt.Fprintf(&out, "ERROR: %s at %04d is missing operands\n", definition.Name, index)
+			break
+		}
+
 		operands, read := ReadOperands(definition, self[index+1:])
 
-		fmt.Fprintf(&out, "%04d %s\n", index, self.fmtInstruction(definition, operands))
+		fmt.Fprintf(&out, "%04d %s\n", index, definition.Format(operands))
 
 		index += (1 + read)
 	}
@@ -155,8 +196,20 @@ func (self Instructions) String() string {
 
 }
 
-func (self Instructions) fmtInstruction(definition *Definition, operands []int) string {
-	operandCount := len(definition.OperandsWidth)
+// Width is the size in bytes of an instruction, the opcode and its operands
+func (self *Definition) Width() int {
+	width := 1
+
+	for _, operandWidth := range self.OperandsWidth {
+		width += operandWidth
+	}
+
+	return width
+}
+
+// Format prints an instruction the way Instructions.String does, without its offset
+func (self *Definition) Format(operands []int) string {
+	operandCount := len(self.OperandsWidth)
 
 	if len(operands) != operandCount {
 		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
@@ -164,14 +217,14 @@ func (self Instructions) fmtInstruction(definition *Definition, operands []int)
 
 	switch operandCount {
 	case 0:
-		return definition.Name
+		return self.Name
 	case 1:
-		return fmt.Sprintf("%s %d", definition.Name, operands[0])
+		return fmt.Sprintf("%s %d", self.Name, operands[0])
 	case 2:
-		return fmt.Sprintf("%s %d %d", definition.Name, operands[0], operands[1])
+		return fmt.Sprintf("%s %d %d", self.Name, operands[0], operands[1])
 	}
 
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", definition.Name)
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", self.Name)
 }
 
 func ReadOperands(definition *Definition, instructions Instructions) ([]int, int) {
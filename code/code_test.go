@@ -53,6 +53,22 @@ func TestInstructionString(t *testing.T) {
 	}
 }
 
+func TestInstructionStringInvalid(t *testing.T) {
+	tableTests := []struct {
+		instructions Instructions
+		expected     string
+	}{
+		{Instructions{255, byte(OpAdd)}, "ERROR: opcode 255 undefined\n0001 OpAdd\n"},
+		{Instructions{byte(OpAdd), byte(OpConstant), 1}, "0000 OpAdd\nERROR: OpConstant at 0001 is missing operands\n"},
+	}
+
+	for _, tt := range tableTests {
+		if tt.instructions.String() != tt.expected {
+			t.Errorf("instruction wrongly formatted.\nwant = %q\ngot = %q", tt.expected, tt.instructions.String())
+		}
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tableTests := []struct {
 		op        Opcode
@@ -86,3 +102,21 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLookUpName(t *testing.T) {
+	for _, op := range []Opcode{OpConstant, OpClosure, OpTailCall} {
+		definition, _ := LookUp(byte(op))
+
+		found, foundDefinition, err := LookUpName(definition.Name)
+
+		if err != nil || found != op || foundDefinition != definition {
+			t.Errorf("%s: wrong lookup. got = %d, %v", definition.Name, found, err)
+		}
+	}
+
+	_, _, err := LookUpName("OpNothing")
+
+	if err == nil {
+		t.Errorf("expected an error for an undefined opcode name")
+	}
+}
@@ -0,0 +1,61 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/Neal-C/compiler-in-go/token"
+)
+
+// SourceMap maps instruction offsets back to the source they were compiled from.
+// It is kept compact: an entry is only recorded when the position changes,
+// and it covers every instruction up to the next entry.
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset   int
+	Position token.Position
+}
+
+// Add records position for the instruction at offset, offsets must be added in increasing order
+func (self SourceMap) Add(offset int, position token.Position) SourceMap {
+	if !position.IsValid() {
+		return self
+	}
+
+	if len(self) > 0 {
+		last := self[len(self)-1]
+
+		if last.Position == position {
+			return self
+		}
+
+		if last.Offset == offset {
+			self[len(self)-1].Position = position
+			return self
+		}
+	}
+
+	return append(self, SourceMapEntry{Offset: offset, Position: position})
+}
+
+// Truncate drops every entry for instructions at or after offset
+func (self SourceMap) Truncate(offset int) SourceMap {
+	index := sort.Search(len(self), func(i int) bool {
+		return self[i].Offset >= offset
+	})
+
+	return self[:index]
+}
+
+// Lookup returns the source position of the instruction containing offset
+func (self SourceMap) Lookup(offset int) (token.Position, bool) {
+	index := sort.Search(len(self), func(i int) bool {
+		return self[i].Offset > offset
+	})
+
+	if index == 0 {
+		return token.Position{}, false
+	}
+
+	return self[index-1].Position, true
+}
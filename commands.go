@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/ast"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/disassembler"
+	"github.com/Neal-C/compiler-in-go/evaluator"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/optimizer"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"github.com/Neal-C/compiler-in-go/token"
+	"github.com/Neal-C/compiler-in-go/verifier"
+	"github.com/Neal-C/compiler-in-go/vm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	engineVM   = "vm"
+	engineEval = "eval"
+)
+
+// exit codes of the subcommands, usage lists them too
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitUsage        = 2
+	exitParseError   = 3
+	exitCompileError = 4
+	exitFileError    = 5
+)
+
+var commands = map[string]func(file string) int{
+	"run":    runCommandRun,
+	"build":  runCommandBuild,
+	"exec":   runCommandExec,
+	"disasm": runCommandDisasm,
+	"tokens": runCommandTokens,
+	"ast":    runCommandAst,
+}
+
+// output is the -o flag of build
+var output string
+
+func runCommand(name string, args []string) int {
+	command, ok := commands[name]
+
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		flag.Usage()
+		return exitUsage
+	}
+
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.BoolVar(optimize, "O", *optimize, "run the peephole optimizer over the compiled bytecode")
+	flagSet.StringVar(engine, "engine", *engine, "run programs in the 'vm' or with the tree-walking 'eval'uator")
+
+	if name == "build" {
+		flagSet.StringVar(&output, "o", "", "bytecode file to write, the source file with a .mbc extension by default")
+	}
+
+	files, err := parseInterspersed(flagSet, args)
+
+	if err != nil {
+		return exitUsage
+	}
+
+	if len(files) != 1 {
+		fmt.Fprintf(os.Stderr, "%s takes exactly one file, got %d\n", name, len(files))
+		return exitUsage
+	}
+
+	if *engine != engineVM && *engine != engineEval {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, want %q or %q\n", *engine, engineVM, engineEval)
+		return exitUsage
+	}
+
+	return command(files[0])
+}
+
+// parseInterspersed lets flags come after the file, `build main.monkey -o main.mbc`,
+// the flag package stops at the first argument that is not a flag
+func parseInterspersed(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		err := flagSet.Parse(args)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if flagSet.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, flagSet.Arg(0))
+		args = flagSet.Args()[1:]
+	}
+}
+
+func runCommandRun(file string) int {
+	program, exitCode := parseFile(file)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	if *engine == engineEval {
+		evaluated := evaluator.Eval(program, object.NewEnvironment())
+
+		if evaluationError, ok := evaluated.(*object.Error); ok {
+			fmt.Fprintf(os.Stderr, "%s: runtime error: %s\n", file, evaluationError.Message)
+			return exitRuntimeError
+		}
+
+		return exitOK
+	}
+
+	bytecode, exitCode := compileProgram(program)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	return runByteCode(bytecode)
+}
+
+func runCommandBuild(file string) int {
+	program, exitCode := parseFile(file)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	bytecode, exitCode := compileProgram(program)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	data, err := compiler.Marshal(bytecode, true)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		return exitCompileError
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(file, filepath.Ext(file)) + ".mbc"
+	}
+
+	err = os.WriteFile(output, data, 0o644)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFileError
+	}
+
+	return exitOK
+}
+
+func runCommandExec(file string) int {
+	bytecode, exitCode := loadByteCode(file)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	// the VM trusts its input, a corrupt or hand-made file must not crash it
+	err := verifier.Verify(bytecode)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid bytecode: %s\n", file, err)
+		return exitFileError
+	}
+
+	return runByteCode(bytecode)
+}
+
+func runCommandDisasm(file string) int {
+	var bytecode *compiler.ByteCode
+	exitCode := exitOK
+
+	if filepath.Ext(file) == ".mbc" {
+		bytecode, exitCode = loadByteCode(file)
+	} else {
+		var program *ast.Program
+		program, exitCode = parseFile(file)
+
+		if exitCode == exitOK {
+			bytecode, exitCode = compileProgram(program)
+		}
+	}
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	fmt.Print(disassembler.Disassemble(bytecode))
+
+	return exitOK
+}
+
+func runCommandTokens(file string) int {
+	source, exitCode := readSource(file)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	monkeyLexer := lexer.NewWithFilename(file, source)
+	monkeyLexer.KeepComments(true)
+
+	for tok := monkeyLexer.NextToken(); ; tok = monkeyLexer.NextToken() {
+		fmt.Printf("%s\t%s\t%q\n", tok.Span.Start, tok.Type, tok.Literal)
+
+		if tok.Type == token.EOF {
+			return exitOK
+		}
+	}
+}
+
+func runCommandAst(file string) int {
+	program, exitCode := parseFile(file)
+
+	if exitCode != exitOK {
+		return exitCode
+	}
+
+	for _, statement := range program.Statements {
+		fmt.Println(statement.String())
+	}
+
+	return exitOK
+}
+
+func readSource(file string) (string, int) {
+	source, err := os.ReadFile(file)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", exitFileError
+	}
+
+	return string(source), exitOK
+}
+
+func parseFile(file string) (*ast.Program, int) {
+	source, exitCode := readSource(file)
+
+	if exitCode != exitOK {
+		return nil, exitCode
+	}
+
+	monkeyParser := parser.New(lexer.NewWithFilename(file, source))
+	program := monkeyParser.ParseProgram()
+
+	if len(monkeyParser.Errors()) != 0 {
+		for _, diagnostic := range monkeyParser.Diagnostics() {
+			fmt.Fprint(os.Stderr, diagnostic.Render(source))
+		}
+
+		return nil, exitParseError
+	}
+
+	return program, exitOK
+}
+
+func compileProgram(program *ast.Program) (*compiler.ByteCode, int) {
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compilation failed: %s\n", err)
+		return nil, exitCompileError
+	}
+
+	bytecode := myCompiler.ByteCode()
+
+	if *optimize {
+		bytecode = optimizer.Optimize(bytecode)
+	}
+
+	return bytecode, exitOK
+}
+
+func loadByteCode(file string) (*compiler.ByteCode, int) {
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitFileError
+	}
+
+	bytecode, err := compiler.Unmarshal(data)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		return nil, exitFileError
+	}
+
+	return bytecode, exitOK
+}
+
+func runByteCode(bytecode *compiler.ByteCode) int {
+	err := vm.New(bytecode).Run()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runtime error: %s\n", err)
+
+		var runtimeError *vm.RuntimeError
+		if errors.As(err, &runtimeError) {
+			fmt.Fprint(os.Stderr, runtimeError.StackTrace.String())
+		}
+
+		return exitRuntimeError
+	}
+
+	return exitOK
+}
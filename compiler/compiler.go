@@ -5,14 +5,19 @@ import (
 	"github.com/Neal-C/compiler-in-go/ast"
 	"github.com/Neal-C/compiler-in-go/code"
 	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/token"
+	"math"
 	"sort"
 )
 
 type Compiler struct {
-	constants   []object.Object
-	symbolTable *SymbolTable
-	scopes      []CompilationScope
-	scopeIndex  int
+	constants       []object.Object
+	constantIndices map[constantKey]int // pool index of every integer, float and string constant
+	symbolTable     *SymbolTable
+	scopes          []CompilationScope
+	scopeIndex      int
+	position        token.Position // source position of the node being compiled
+	foldConstants   bool
 }
 
 type EmittedInstruction struct {
@@ -21,14 +26,26 @@ type EmittedInstruction struct {
 }
 
 type ByteCode struct {
-	Instructions code.Instructions
-	Constants    []object.Object
+	Instructions    code.Instructions
+	Constants       []object.Object
+	SourceMap       code.SourceMap
+	NumberOfGlobals int      // the VM sizes its globals from it
+	GlobalNames     []string // debug info, the variable of each global slot
 }
 
 type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+	loops               []*Loop                      // enclosing loops, innermost last
+	tailCalls           map[*ast.CallExpression]bool // calls compiled to OpTailCall, see findTailCalls
+}
+
+// Loop is a loop being compiled, break jumps are back-patched once its end is known
+type Loop struct {
+	continuePosition int
+	breakPositions   []int
 }
 
 func New() *Compiler {
@@ -46,17 +63,33 @@ func New() *Compiler {
 	}
 
 	return &Compiler{
-		constants:   []object.Object{},
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
-		symbolTable: symbolTable,
+		constants:       []object.Object{},
+		constantIndices: make(map[constantKey]int),
+		scopes:          []CompilationScope{mainScope},
+		scopeIndex:      0,
+		symbolTable:     symbolTable,
+		foldConstants:   true,
 	}
 }
 
+// SetConstantFolding turns compile time evaluation of constant expressions on or off, it is on by default
+func (self *Compiler) SetConstantFolding(enabled bool) {
+	self.foldConstants = enabled
+}
+
 func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = symbolTable
 	compiler.constants = constants
+
+	for index, constant := range constants {
+		if key, ok := newConstantKey(constant); ok {
+			if _, seen := compiler.constantIndices[key]; !seen {
+				compiler.constantIndices[key] = index
+			}
+		}
+	}
+
 	return compiler
 }
 
@@ -66,6 +99,10 @@ func (self *Compiler) currentInstructions() code.Instructions {
 
 func (self *Compiler) Compile(node ast.Node) error {
 
+	previousPosition := self.position
+	self.position = sourcePosition(node, previousPosition)
+	defer func() { self.position = previousPosition }()
+
 	switch node := node.(type) {
 	case *ast.Program:
 
@@ -88,8 +125,17 @@ func (self *Compiler) Compile(node ast.Node) error {
 
 	case *ast.InfixExpression:
 
+		if folded, ok := self.fold(node); ok {
+			self.emitConstant(folded)
+			return nil
+		}
+
+		if node.Operator == "&&" || node.Operator == "||" {
+			return self.compileLogicalExpression(node)
+		}
+
 		// Compiler magic, right there
-		if node.Operator == "<" {
+		if node.Operator == "<" || node.Operator == "<=" {
 			err := self.Compile(node.Right)
 			if err != nil {
 				return err
@@ -100,7 +146,11 @@ func (self *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			self.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				self.emit(code.OpGreaterThan)
+			} else {
+				self.emit(code.OpGreaterThanOrEqual)
+			}
 			return nil
 
 		}
@@ -124,8 +174,12 @@ func (self *Compiler) Compile(node ast.Node) error {
 			self.emit(code.OpMul)
 		case "/":
 			self.emit(code.OpDiv)
+		case "%":
+			self.emit(code.OpMod)
 		case ">":
 			self.emit(code.OpGreaterThan)
+		case ">=":
+			self.emit(code.OpGreaterThanOrEqual)
 		case "==":
 			self.emit(code.OpEqual)
 		case "!=":
@@ -136,6 +190,9 @@ func (self *Compiler) Compile(node ast.Node) error {
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		self.emit(code.OpConstant, self.addConstants(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		self.emit(code.OpConstant, self.addConstants(float))
 	case *ast.Boolean:
 		if node.Value {
 			self.emit(code.OpTrue)
@@ -143,6 +200,11 @@ func (self *Compiler) Compile(node ast.Node) error {
 			self.emit(code.OpFalse)
 		}
 	case *ast.PrefixExpression:
+		if folded, ok := self.fold(node); ok {
+			self.emitConstant(folded)
+			return nil
+		}
+
 		err := self.Compile(node.Right)
 
 		if err != nil {
@@ -169,16 +231,12 @@ func (self *Compiler) Compile(node ast.Node) error {
 		// Emit with a bogus value that gets back-patched later
 		jumpNotTruthyPosition := self.emit(code.OpJumpNotTruthy, 9999)
 
-		err = self.Compile(node.Consequence)
+		err = self.compileBranch(node.Consequence)
 
 		if err != nil {
 			return err
 		}
 
-		if self.lastInstructionIs(code.OpPop) {
-			self.removeLastPop()
-		}
-
 		jumpOverAlternativePosition := self.emit(code.OpJump, 9999)
 
 		afterConsequencePos := len(self.currentInstructions())
@@ -188,15 +246,11 @@ func (self *Compiler) Compile(node ast.Node) error {
 			self.emit(code.OpNull)
 		} else {
 
-			err = self.Compile(node.Alternative)
+			err = self.compileBranch(node.Alternative)
 
 			if err != nil {
 				return err
 			}
-
-			if self.lastInstructionIs(code.OpPop) {
-				self.removeLastPop()
-			}
 		}
 
 		afterAlternativePosition := len(self.currentInstructions())
@@ -233,7 +287,7 @@ func (self *Compiler) Compile(node ast.Node) error {
 
 		if !ok {
 			// Compile time errors !!
-			return fmt.Errorf("undefined variable : %s", node.Value)
+			return fmt.Errorf("%s: undefined variable : %s", node.Span().Start, node.Value)
 		}
 
 		self.loadSymbol(symbol)
@@ -304,6 +358,8 @@ func (self *Compiler) Compile(node ast.Node) error {
 
 		self.enterScope()
 
+		self.scopes[self.scopeIndex].tailCalls = findTailCalls(node.Body)
+
 		if node.Name != "" {
 			self.symbolTable.DefineFunctionName(node.Name)
 		}
@@ -328,22 +384,149 @@ func (self *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := self.symbolTable.FreeSymbols
 		numberOfLocals := self.symbolTable.numberOfDefinitions
+		localNames := self.symbolTable.DefinitionNames()
+		sourceMap := self.scopes[self.scopeIndex].sourceMap
 		instructions := self.leaveScope()
 
 		for _, symbol := range freeSymbols {
-			self.loadSymbol(symbol)
+			self.captureSymbol(symbol)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:       instructions,
 			NumberOfLocals:     numberOfLocals,
 			NumberOfParameters: len(node.Parameters),
+			SourceMap:          sourceMap,
+			Name:               node.Name,
+			LocalNames:         localNames,
+			FreeNames:          make([]string, len(freeSymbols)),
+		}
+
+		for index, symbol := range freeSymbols {
+			compiledFn.FreeNames[index] = symbol.Name
 		}
 
 		fnIndex := self.addConstants(compiledFn)
 
 		self.emit(code.OpClosure, fnIndex, len(freeSymbols))
 
+	case *ast.AssignExpression:
+
+		err := self.compileAssignExpression(node)
+
+		if err != nil {
+			return err
+		}
+
+	case *ast.WhileStatement:
+
+		loopStart := len(self.currentInstructions())
+
+		err := self.Compile(node.Condition)
+
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPosition := self.emit(code.OpJumpNotTruthy, 9999)
+
+		self.enterLoop(loopStart)
+
+		err = self.Compile(node.Body)
+
+		if err != nil {
+			return err
+		}
+
+		self.emit(code.OpJump, loopStart)
+
+		afterLoopPosition := len(self.currentInstructions())
+		self.changeOperand(jumpNotTruthyPosition, afterLoopPosition)
+		self.leaveLoop(afterLoopPosition)
+
+		// the condition is the last value popped, a loop leaves null like it does in the evaluator
+		self.emit(code.OpNull)
+		self.emit(code.OpPop)
+
+	case *ast.ForStatement:
+
+		err := self.Compile(node.Iterable)
+
+		if err != nil {
+			return err
+		}
+
+		// the loop walks hidden items and index variables, $ keeps them out of reach of Monkey code
+		self.emit(code.OpIterable)
+		items := self.symbolTable.Define("$items")
+		self.storeSymbol(items)
+
+		self.emit(code.OpConstant, self.addConstants(&object.Integer{Value: 0}))
+		index := self.symbolTable.Define("$index")
+		self.storeSymbol(index)
+
+		variable := self.symbolTable.Define(node.Variable.Value)
+
+		loopStart := len(self.currentInstructions())
+
+		// len($items) > $index
+		self.emit(code.OpGetBuiltin, builtinIndex("len"))
+		self.loadSymbol(items)
+		self.emit(code.OpCall, 1)
+		self.loadSymbol(index)
+		self.emit(code.OpGreaterThan)
+
+		jumpNotTruthyPosition := self.emit(code.OpJumpNotTruthy, 9999)
+
+		// variable = $items[$index]; $index = $index + 1
+		self.loadSymbol(items)
+		self.loadSymbol(index)
+		self.emit(code.OpIndex)
+		self.storeSymbol(variable)
+
+		self.loadSymbol(index)
+		self.emit(code.OpConstant, self.addConstants(&object.Integer{Value: 1}))
+		self.emit(code.OpAdd)
+		self.storeSymbol(index)
+
+		self.enterLoop(loopStart)
+
+		err = self.Compile(node.Body)
+
+		if err != nil {
+			return err
+		}
+
+		self.emit(code.OpJump, loopStart)
+
+		afterLoopPosition := len(self.currentInstructions())
+		self.changeOperand(jumpNotTruthyPosition, afterLoopPosition)
+		self.leaveLoop(afterLoopPosition)
+
+		// the condition is the last value popped, a loop leaves null like it does in the evaluator
+		self.emit(code.OpNull)
+		self.emit(code.OpPop)
+
+	case *ast.BreakStatement:
+
+		loop := self.currentLoop()
+
+		if loop == nil {
+			return fmt.Errorf("%s: break outside of a loop", node.Span().Start)
+		}
+
+		loop.breakPositions = append(loop.breakPositions, self.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+
+		loop := self.currentLoop()
+
+		if loop == nil {
+			return fmt.Errorf("%s: continue outside of a loop", node.Span().Start)
+		}
+
+		self.emit(code.OpJump, loop.continuePosition)
+
 	case *ast.ReturnStatement:
 
 		err := self.Compile(node.ReturnValue)
@@ -369,24 +552,222 @@ func (self *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
-		self.emit(code.OpCall, len(node.Arguments))
+		if self.scopes[self.scopeIndex].tailCalls[node] {
+			self.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			self.emit(code.OpCall, len(node.Arguments))
+		}
 
 	}
 
 	return nil
 }
 
+// compileLogicalExpression short-circuits && and || with jumps, the right operand
+// only runs when it decides the result. Both produce a boolean:
+//
+//	a && b : a, JumpNotTruthy false, b, Bang, Bang, Jump end, false: False
+//	a || b : a, JumpNotTruthy right, True, Jump end, right: b, Bang, Bang
+func (self *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := self.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpNotTruthyPosition := self.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		err = self.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		self.emit(code.OpBang)
+		self.emit(code.OpBang)
+
+		jumpToEndPosition := self.emit(code.OpJump, 9999)
+
+		self.changeOperand(jumpNotTruthyPosition, len(self.currentInstructions()))
+		self.emit(code.OpFalse)
+
+		self.changeOperand(jumpToEndPosition, len(self.currentInstructions()))
+
+		return nil
+	}
+
+	self.emit(code.OpTrue)
+
+	jumpToEndPosition := self.emit(code.OpJump, 9999)
+
+	self.changeOperand(jumpNotTruthyPosition, len(self.currentInstructions()))
+
+	err = self.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	self.emit(code.OpBang)
+	self.emit(code.OpBang)
+
+	self.changeOperand(jumpToEndPosition, len(self.currentInstructions()))
+
+	return nil
+}
+
+var compoundAssignOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+// compileAssignExpression stores the new value and loads it back, an assignment is an expression.
+// A compound assignment loads the variable first: x += 1 is x = x + 1
+func (self *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return self.compileIndexAssignment(node, target)
+	}
+
+	target, ok := node.Target.(*ast.Identifier)
+
+	if !ok {
+		return fmt.Errorf("%s: cannot assign to %s", node.Span().Start, node.Target.String())
+	}
+
+	symbol, ok := self.symbolTable.Resolve(target.Value)
+
+	if !ok {
+		return fmt.Errorf("%s: undefined variable : %s", target.Span().Start, target.Value)
+	}
+
+	if symbol.Scope == BuiltinScope || symbol.Scope == FunctionScope {
+		return fmt.Errorf("%s: cannot assign to %s", target.Span().Start, target.Value)
+	}
+
+	if node.Operator != "=" {
+		self.loadSymbol(symbol)
+	}
+
+	err := self.Compile(node.Value)
+
+	if err != nil {
+		return err
+	}
+
+	err = self.emitCompoundOperator(node.Operator)
+
+	if err != nil {
+		return err
+	}
+
+	self.storeSymbol(symbol)
+	self.loadSymbol(symbol)
+
+	return nil
+}
+
+// compileIndexAssignment leaves the collection, the index and the value for OpSetIndex.
+// A compound assignment duplicates the collection and the index to read the current element,
+// so that neither is evaluated twice
+func (self *Compiler) compileIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression) error {
+	err := self.Compile(target.Left)
+
+	if err != nil {
+		return err
+	}
+
+	err = self.Compile(target.Index)
+
+	if err != nil {
+		return err
+	}
+
+	if node.Operator != "=" {
+		self.emit(code.OpDup, 2)
+		self.emit(code.OpIndex)
+	}
+
+	err = self.Compile(node.Value)
+
+	if err != nil {
+		return err
+	}
+
+	err = self.emitCompoundOperator(node.Operator)
+
+	if err != nil {
+		return err
+	}
+
+	self.emit(code.OpSetIndex)
+
+	return nil
+}
+
+// emitCompoundOperator emits the arithmetic of a compound assignment, nothing for a plain =
+func (self *Compiler) emitCompoundOperator(operator string) error {
+	if operator == "=" {
+		return nil
+	}
+
+	opcode, ok := compoundAssignOperators[operator]
+
+	if !ok {
+		return fmt.Errorf("unknown operator : %s", operator)
+	}
+
+	self.emit(opcode)
+
+	return nil
+}
+
 func (self *Compiler) ByteCode() *ByteCode {
 	return &ByteCode{
-		Instructions: self.currentInstructions(),
-		Constants:    self.constants,
+		Instructions:    self.currentInstructions(),
+		Constants:       self.constants,
+		SourceMap:       self.scopes[self.scopeIndex].sourceMap,
+		NumberOfGlobals: self.symbolTable.numberOfDefinitions,
+		GlobalNames:     self.symbolTable.DefinitionNames(),
 	}
 }
 
+// addConstants returns the pool index of obj, equal integers, floats and strings share one entry
 func (self *Compiler) addConstants(obj object.Object) int {
+	key, dedupe := newConstantKey(obj)
+
+	if dedupe {
+		if index, ok := self.constantIndices[key]; ok {
+			return index
+		}
+	}
+
 	self.constants = append(self.constants, obj)
+	index := len(self.constants) - 1
+
+	if dedupe {
+		self.constantIndices[key] = index
+	}
 
-	return len(self.constants) - 1
+	return index
+}
+
+// constantKey identifies a constant by value, equal integers, floats and strings share a pool entry
+type constantKey struct {
+	objectType object.ObjectType
+	value      any
+}
+
+func newConstantKey(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.Float:
+		return constantKey{obj.Type(), math.Float64bits(obj.Value)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
 }
 
 func (self *Compiler) addInstruction(instructions code.Instructions) int {
@@ -405,6 +786,9 @@ func (self *Compiler) emit(op code.Opcode, operands ...int) int {
 
 	self.setLastInstruction(op, position)
 
+	scope := &self.scopes[self.scopeIndex]
+	scope.sourceMap = scope.sourceMap.Add(position, self.position)
+
 	return position
 }
 
@@ -417,6 +801,37 @@ func (self *Compiler) setLastInstruction(op code.Opcode, position int) {
 	self.scopes[self.scopeIndex].lastInstruction = last
 }
 
+// compileBranch compiles a branch of an if so that it leaves its value on the stack: the value of its last
+// expression statement, or null when it ends with a let, a loop or nothing at all.
+// A branch ending with return, break or continue never gets to the end, it pushes nothing.
+func (self *Compiler) compileBranch(block *ast.BlockStatement) error {
+	err := self.Compile(block)
+
+	if err != nil {
+		return err
+	}
+
+	var last ast.Statement
+
+	if len(block.Statements) > 0 {
+		last = block.Statements[len(block.Statements)-1]
+	}
+
+	switch last.(type) {
+	case *ast.ExpressionStatement:
+		if self.lastInstructionIs(code.OpPop) {
+			self.removeLastPop()
+			return nil
+		}
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return nil
+	}
+
+	self.emit(code.OpNull)
+
+	return nil
+}
+
 func (self *Compiler) lastInstructionIs(op code.Opcode) bool {
 
 	if len(self.currentInstructions()) == 0 {
@@ -435,6 +850,7 @@ func (self *Compiler) removeLastPop() {
 
 	self.scopes[self.scopeIndex].instructions = newInstructions
 	self.scopes[self.scopeIndex].lastInstruction = previous
+	self.scopes[self.scopeIndex].sourceMap = self.scopes[self.scopeIndex].sourceMap.Truncate(last.Position)
 
 }
 
@@ -493,6 +909,57 @@ func (self *Compiler) replaceLastPopWithReturn() {
 
 }
 
+func (self *Compiler) storeSymbol(symbl Symbol) {
+	switch symbl.Scope {
+	case GlobalScope:
+		self.emit(code.OpSetGlobal, symbl.Index)
+	case LocalScope:
+		self.emit(code.OpSetLocal, symbl.Index)
+	case FreeScope:
+		self.emit(code.OpSetFree, symbl.Index)
+	default:
+		panic("[*Compiler::storeSymbol] : unhandled case")
+	}
+}
+
+func (self *Compiler) enterLoop(continuePosition int) {
+	scope := &self.scopes[self.scopeIndex]
+	scope.loops = append(scope.loops, &Loop{continuePosition: continuePosition})
+}
+
+// leaveLoop points every break of the innermost loop at afterLoopPosition
+func (self *Compiler) leaveLoop(afterLoopPosition int) {
+	scope := &self.scopes[self.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+
+	for _, position := range loop.breakPositions {
+		self.changeOperand(position, afterLoopPosition)
+	}
+
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+// currentLoop is nil outside of a loop, a function body does not see the loops around it
+func (self *Compiler) currentLoop() *Loop {
+	loops := self.scopes[self.scopeIndex].loops
+
+	if len(loops) == 0 {
+		return nil
+	}
+
+	return loops[len(loops)-1]
+}
+
+func builtinIndex(name string) int {
+	for index, definition := range object.Builtins {
+		if definition.Name == name {
+			return index
+		}
+	}
+
+	panic("[compiler::builtinIndex] : unknown builtin " + name)
+}
+
 func (self *Compiler) loadSymbol(symbl Symbol) {
 	switch symbl.Scope {
 	case GlobalScope:
@@ -509,3 +976,43 @@ func (self *Compiler) loadSymbol(symbl Symbol) {
 		panic("[*Compiler::loadSymbol] : unhandled case")
 	}
 }
+
+// captureSymbol pushes what OpClosure keeps for a free variable: the cell of a local or free variable,
+// so that assignments are shared with the enclosing scope, or the value itself for the current closure
+func (self *Compiler) captureSymbol(symbl Symbol) {
+	switch symbl.Scope {
+	case LocalScope:
+		self.emit(code.OpGetLocalCell, symbl.Index)
+	case FreeScope:
+		self.emit(code.OpGetFreeCell, symbl.Index)
+	default:
+		self.loadSymbol(symbl)
+	}
+}
+
+// sourcePosition picks the position instructions of node are attributed to:
+// the operator for infix, call and index expressions, the start of the node otherwise
+func sourcePosition(node ast.Node, fallback token.Position) token.Position {
+	var position token.Position
+
+	switch node := node.(type) {
+	case nil:
+		return fallback
+	case *ast.InfixExpression:
+		position = node.Token.Span.Start
+	case *ast.CallExpression:
+		position = node.Token.Span.Start
+	case *ast.IndexExpression:
+		position = node.Token.Span.Start
+	case *ast.AssignExpression:
+		position = node.Token.Span.Start
+	default:
+		position = node.Span().Start
+	}
+
+	if !position.IsValid() {
+		return fallback
+	}
+
+	return position
+}
@@ -82,13 +82,20 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tableTests)
 }
 
+// runCompilerTests checks what each node compiles to, without constant folding to hide it
 func runCompilerTests(t *testing.T, tests []CompilerTestCase) {
 	t.Helper()
+	runCompilerTestsWithFolding(t, tests, false)
+}
+
+func runCompilerTestsWithFolding(t *testing.T, tests []CompilerTestCase, folding bool) {
+	t.Helper()
 
 	for _, tt := range tests {
 		program := parse(tt.input)
 
 		myCompiler := New()
+		myCompiler.SetConstantFolding(folding)
 
 		err := myCompiler.Compile(program)
 
@@ -160,6 +167,13 @@ func testConstants(expectedConstants []any, actualObjects []object.Object) error
 				return fmt.Errorf("constant %d - testIntegerObject failed : %s ", index, err)
 			}
 
+		case float64:
+			float, ok := actualObjects[index].(*object.Float)
+
+			if !ok || float.Value != constant {
+				return fmt.Errorf("constant %d - not the float %g. got = %T (%+v)", index, constant, actualObjects[index], actualObjects[index])
+			}
+
 		case string:
 			err := testStringObject(constant, actualObjects[index])
 
@@ -539,14 +553,14 @@ func TestIndexExpressions(t *testing.T) {
 	testTable := []CompilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []any{1, 2, 3, 1, 1},
+			expectedConstants: []any{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -554,13 +568,13 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []any{1, 2, 2, 1},
+			expectedConstants: []any{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -905,7 +919,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -935,7 +949,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -979,15 +993,15 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1020,16 +1034,15 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -1049,21 +1062,20 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 				[]code.Instructions{
 					code.Make(code.OpClosure, 1, 0),
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -1074,3 +1086,578 @@ func TestRecursiveFunctions(t *testing.T) {
 
 	runCompilerTests(t, testTable)
 }
+
+func TestTailCalls(t *testing.T) {
+	testTable := []CompilerTestCase{
+		{
+			input: `fn(f) { return f(); }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { if (true) { f() } else { f() + 1 } }`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 11),
+					// 0004
+					code.Make(code.OpGetLocal, 0),
+					// 0006
+					code.Make(code.OpTailCall, 0),
+					// 0008
+					code.Make(code.OpJump, 19),
+					// 0011
+					code.Make(code.OpGetLocal, 0),
+					// 0013
+					code.Make(code.OpCall, 0),
+					// 0015
+					code.Make(code.OpConstant, 0),
+					// 0018
+					code.Make(code.OpAdd),
+					// 0019
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { if (f()) { return f(); }; f(); 1 }`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpCall, 0),
+					// 0004
+					code.Make(code.OpJumpNotTruthy, 15),
+					// 0007
+					code.Make(code.OpGetLocal, 0),
+					// 0009
+					code.Make(code.OpTailCall, 0),
+					// 0011
+					code.Make(code.OpReturnValue),
+					// 0012
+					code.Make(code.OpJump, 16),
+					// 0015
+					code.Make(code.OpNull),
+					// 0016
+					code.Make(code.OpPop),
+					// 0017
+					code.Make(code.OpGetLocal, 0),
+					// 0019
+					code.Make(code.OpCall, 0),
+					// 0021
+					code.Make(code.OpPop),
+					// 0022
+					code.Make(code.OpConstant, 0),
+					// 0025
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the inner call is in tail position of the inner function only
+			input: `fn(f) { fn() { f() }; f(f()) }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testTable)
+}
+
+func TestSourceMap(t *testing.T) {
+	input := `1 +
+  2;
+fn() { 3 }`
+
+	myCompiler := New()
+	myCompiler.SetConstantFolding(false)
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := myCompiler.ByteCode()
+
+	tableTests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:1"},  // OpConstant 0
+		{3, "2:3"},  // OpConstant 1
+		{4, "2:3"},  // operand of OpConstant 1
+		{6, "1:3"},  // OpAdd
+		{7, "1:1"},  // OpPop
+		{8, "3:1"},  // OpClosure
+		{12, "3:1"}, // OpPop
+	}
+
+	for _, tt := range tableTests {
+		position, ok := bytecode.SourceMap.Lookup(tt.offset)
+
+		if !ok {
+			t.Fatalf("no position for offset %d", tt.offset)
+		}
+
+		if position.String() != tt.expected {
+			t.Errorf("wrong position for offset %d. want = %s, got = %s", tt.offset, tt.expected, position)
+		}
+	}
+
+	fn, ok := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+
+	if !ok {
+		t.Fatalf("last constant is not a function: %T", bytecode.Constants[len(bytecode.Constants)-1])
+	}
+
+	position, ok := fn.SourceMap.Lookup(0)
+
+	if !ok || position.String() != "3:8" {
+		t.Errorf("wrong position for the function body. got = %s", position)
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []any{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-2.5e3",
+			expectedConstants: []any{2500.0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "1 <= 2",
+			expectedConstants: []any{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "5 % 2",
+			expectedConstants: []any{5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpBang),
+				// 0006
+				code.Make(code.OpBang),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpFalse),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "false || true",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 11),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpBang),
+				// 0010
+				code.Make(code.OpBang),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "while (true) { 1; break; continue; }",
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 17),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 17),
+				// 0011
+				code.Make(code.OpJump, 0),
+				// 0014
+				code.Make(code.OpJump, 0),
+				// 0017
+				code.Make(code.OpNull),
+				// 0018
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+}
+
+func TestLoopControlOutsideOfLoops(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"while (true) { fn() { continue; } }", "1:23: continue outside of a loop"},
+	}
+
+	for _, tt := range tableTests {
+		err := New().Compile(parse(tt.input))
+
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want = %q, got = %q", tt.expected, err)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(x) { x += 2 }",
+			expectedConstants: []any{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let count = 0;
+				fn() { count *= 3 }
+			}
+			`,
+			expectedConstants: []any{
+				0,
+				3,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1;", "1:1: undefined variable : x"},
+		{"len = 1;", "1:1: cannot assign to len"},
+		{"let f = fn() { f = 1; };", "1:16: cannot assign to f"},
+	}
+
+	for _, tt := range tableTests {
+		err := New().Compile(parse(tt.input))
+
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want = %q, got = %q", tt.expected, err)
+		}
+	}
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "[1][0] = 2",
+			expectedConstants: []any{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{}[\"k\"] -= 1",
+			expectedConstants: []any{"k", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+}
+
+func TestConstantFolding(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input:             "2 * 60 * 60",
+			expectedConstants: []any{7200},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"a" + "b" + "c"`,
+			expectedConstants: []any{"abc"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-(1 + 2) * 3 % 4; !(1 < 2) == false; true && 1 > 2 || !false",
+			expectedConstants: []any{-1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// only the constant operand folds, the division by zero is left to fail at runtime
+			input:             "let x = 1; x + 2 * 3; 1 / 0",
+			expectedConstants: []any{1, 6, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1 + "a"; 1 == true; 1.5 + 1`,
+			expectedConstants: []any{1, "a", 1.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpTrue),
+				code.Make(code.OpEqual),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithFolding(t, tableTests, true)
+}
+
+func TestConstantDeduplication(t *testing.T) {
+	tableTests := []CompilerTestCase{
+		{
+			input: `1; "one"; 1.0; 1; "one"; 1.0; fn() { 1 }`,
+			expectedConstants: []any{
+				1,
+				"one",
+				1.0,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tableTests)
+
+	// the REPL compiles every line against the constants of the previous ones
+	constants := []object.Object{&object.Integer{Value: 7}}
+	myCompiler := NewWithState(NewSymbolTable(), constants)
+
+	err := myCompiler.Compile(parse("7"))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if len(myCompiler.ByteCode().Constants) != 1 {
+		t.Errorf("wrong number of constants. want = 1, got = %d", len(myCompiler.ByteCode().Constants))
+	}
+}
@@ -0,0 +1,159 @@
+package compiler
+
+import (
+	"github.com/Neal-C/compiler-in-go/ast"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/object"
+)
+
+// foldConstant evaluates a pure expression over integer, boolean and string literals at compile time,
+// `2 * 60 * 60` becomes 7200 and `"a" + "b"` becomes "ab".
+// It reports false for anything else, and for what fails at runtime (division by zero, type mismatches),
+// so that the VM still raises those errors at the right position.
+func foldConstant(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+	case *ast.Boolean:
+		return &object.Boolean{Value: node.Value}, true
+	case *ast.PrefixExpression:
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldPrefix(node.Operator, right)
+	case *ast.InfixExpression:
+		left, ok := foldConstant(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := foldConstant(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldInfix(node.Operator, left, right)
+	default:
+		return nil, false
+	}
+}
+
+func foldPrefix(operator string, right object.Object) (object.Object, bool) {
+	switch operator {
+	case "!":
+		return &object.Boolean{Value: !isTruthyConstant(right)}, true
+	case "-":
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false
+		}
+		return &object.Integer{Value: -integer.Value}, true
+	default:
+		return nil, false
+	}
+}
+
+func foldInfix(operator string, left object.Object, right object.Object) (object.Object, bool) {
+	// like the VM, && and || produce a boolean whatever the operands are
+	switch operator {
+	case "&&":
+		return &object.Boolean{Value: isTruthyConstant(left) && isTruthyConstant(right)}, true
+	case "||":
+		return &object.Boolean{Value: isTruthyConstant(left) || isTruthyConstant(right)}, true
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			return foldIntegerInfix(operator, left.Value, right.Value)
+		}
+	case *object.Boolean:
+		if right, ok := right.(*object.Boolean); ok {
+			return foldBooleanInfix(operator, left.Value, right.Value)
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok && operator == "+" {
+			return &object.String{Value: left.Value + right.Value}, true
+		}
+	}
+
+	return nil, false
+}
+
+func foldIntegerInfix(operator string, left int64, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return &object.Integer{Value: left + right}, true
+	case "-":
+		return &object.Integer{Value: left - right}, true
+	case "*":
+		return &object.Integer{Value: left * right}, true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Integer{Value: left / right}, true
+	case "%":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Integer{Value: left % right}, true
+	case "<":
+		return &object.Boolean{Value: left < right}, true
+	case ">":
+		return &object.Boolean{Value: left > right}, true
+	case "<=":
+		return &object.Boolean{Value: left <= right}, true
+	case ">=":
+		return &object.Boolean{Value: left >= right}, true
+	case "==":
+		return &object.Boolean{Value: left == right}, true
+	case "!=":
+		return &object.Boolean{Value: left != right}, true
+	default:
+		return nil, false
+	}
+}
+
+func foldBooleanInfix(operator string, left bool, right bool) (object.Object, bool) {
+	switch operator {
+	case "==":
+		return &object.Boolean{Value: left == right}, true
+	case "!=":
+		return &object.Boolean{Value: left != right}, true
+	default:
+		return nil, false
+	}
+}
+
+// isTruthyConstant follows the VM, only false is falsy among the constants that fold
+func isTruthyConstant(obj object.Object) bool {
+	if boolean, ok := obj.(*object.Boolean); ok {
+		return boolean.Value
+	}
+
+	return true
+}
+
+func (self *Compiler) fold(node ast.Expression) (object.Object, bool) {
+	if !self.foldConstants {
+		return nil, false
+	}
+
+	return foldConstant(node)
+}
+
+// emitConstant emits a folded constant, booleans have their own opcodes
+func (self *Compiler) emitConstant(obj object.Object) {
+	if boolean, ok := obj.(*object.Boolean); ok {
+		if boolean.Value {
+			self.emit(code.OpTrue)
+		} else {
+			self.emit(code.OpFalse)
+		}
+		return
+	}
+
+	self.emit(code.OpConstant, self.addConstants(obj))
+}
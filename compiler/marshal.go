@@ -0,0 +1,405 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/token"
+	"hash/crc32"
+	"math"
+)
+
+// The .mbc format, all integers are unsigned varints unless said otherwise:
+//
+//	magic       "MBC\x1a"
+//	version     2 bytes, big endian
+//	flags       1 byte, flagDebugInfo when source maps and names follow
+//	globals     NumberOfGlobals
+//	files       with debug info only: count, then each filename of the source maps
+//	names       with debug info only: GlobalNames
+//	main        instructions, source map
+//	constants   count, then each a tag byte and its value
+//	checksum    4 bytes, big endian, CRC-32 (IEEE) of everything before it
+//
+// Instructions are a length and the raw bytes, a list of names a count and each string.
+// A source map is a count, then for each entry the instruction offset and the file index, offset, line
+// and column of its position.
+// A function constant is its name, LocalNames, FreeNames and source map (debug info only), NumberOfLocals,
+// NumberOfParameters and instructions.
+const (
+	FormatVersion = 1
+	formatMagic   = "MBC\x1a"
+	flagDebugInfo = 1 << 0
+)
+
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagFunction
+)
+
+var (
+	ErrInvalidMagic       = errors.New("not a monkey bytecode file")
+	ErrUnsupportedVersion = errors.New("unsupported bytecode version")
+	ErrChecksumMismatch   = errors.New("bytecode checksum mismatch")
+)
+
+// Marshal encodes bytecode in the .mbc format. Source maps and names are only kept with includeDebugInfo,
+// without them runtime errors have no source position.
+func Marshal(bytecode *ByteCode, includeDebugInfo bool) ([]byte, error) {
+	encoder := &encoder{debugInfo: includeDebugInfo, fileIndices: make(map[string]int)}
+
+	encoder.buffer.WriteString(formatMagic)
+	encoder.buffer.Write(binary.BigEndian.AppendUint16(nil, FormatVersion))
+
+	if includeDebugInfo {
+		encoder.buffer.WriteByte(flagDebugInfo)
+	} else {
+		encoder.buffer.WriteByte(0)
+	}
+
+	encoder.writeInt(bytecode.NumberOfGlobals)
+
+	if includeDebugInfo {
+		encoder.writeFiles(bytecode)
+		encoder.writeStrings(bytecode.GlobalNames)
+	}
+
+	encoder.writeInstructions(bytecode.Instructions)
+	encoder.writeSourceMap(bytecode.SourceMap)
+
+	encoder.writeInt(len(bytecode.Constants))
+
+	for _, constant := range bytecode.Constants {
+		err := encoder.writeConstant(constant)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := crc32.ChecksumIEEE(encoder.buffer.Bytes())
+	encoder.buffer.Write(binary.BigEndian.AppendUint32(nil, checksum))
+
+	return encoder.buffer.Bytes(), nil
+}
+
+// Unmarshal decodes bytecode Marshal encoded, after checking its magic header, version and checksum
+func Unmarshal(data []byte) (*ByteCode, error) {
+	headerSize := len(formatMagic) + 2 + 1
+
+	if len(data) < headerSize+4 || string(data[:len(formatMagic)]) != formatMagic {
+		return nil, ErrInvalidMagic
+	}
+
+	version := binary.BigEndian.Uint16(data[len(formatMagic):])
+
+	if version != FormatVersion {
+		return nil, fmt.Errorf("%w: %d, want %d", ErrUnsupportedVersion, version, FormatVersion)
+	}
+
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, ErrChecksumMismatch
+	}
+
+	decoder := &decoder{data: body, offset: headerSize, debugInfo: data[headerSize-1]&flagDebugInfo != 0}
+
+	bytecode := &ByteCode{}
+	bytecode.NumberOfGlobals = decoder.readInt()
+
+	if decoder.debugInfo {
+		decoder.readFiles()
+		bytecode.GlobalNames = decoder.readStrings()
+	}
+
+	bytecode.Instructions = decoder.readInstructions()
+	bytecode.SourceMap = decoder.readSourceMap()
+
+	numberOfConstants := decoder.readInt()
+
+	for i := 0; i < numberOfConstants && decoder.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, decoder.readConstant())
+	}
+
+	if decoder.err == nil && decoder.offset != len(body) {
+		decoder.fail("%d trailing bytes", len(body)-decoder.offset)
+	}
+
+	if decoder.err != nil {
+		return nil, decoder.err
+	}
+
+	return bytecode, nil
+}
+
+type encoder struct {
+	buffer      bytes.Buffer
+	debugInfo   bool
+	fileIndices map[string]int
+}
+
+func (self *encoder) writeInt(value int) {
+	self.buffer.Write(binary.AppendUvarint(nil, uint64(value)))
+}
+
+func (self *encoder) writeString(value string) {
+	self.writeInt(len(value))
+	self.buffer.WriteString(value)
+}
+
+func (self *encoder) writeStrings(values []string) {
+	self.writeInt(len(values))
+
+	for _, value := range values {
+		self.writeString(value)
+	}
+}
+
+func (self *encoder) writeInstructions(instructions code.Instructions) {
+	self.writeInt(len(instructions))
+	self.buffer.Write(instructions)
+}
+
+// writeFiles writes the filenames of every source map once, entries refer to them by index
+func (self *encoder) writeFiles(bytecode *ByteCode) {
+	var files []string
+
+	addFiles := func(sourceMap code.SourceMap) {
+		for _, entry := range sourceMap {
+			if _, ok := self.fileIndices[entry.Position.Filename]; !ok {
+				self.fileIndices[entry.Position.Filename] = len(files)
+				files = append(files, entry.Position.Filename)
+			}
+		}
+	}
+
+	addFiles(bytecode.SourceMap)
+
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			addFiles(fn.SourceMap)
+		}
+	}
+
+	self.writeInt(len(files))
+
+	for _, file := range files {
+		self.writeString(file)
+	}
+}
+
+func (self *encoder) writeSourceMap(sourceMap code.SourceMap) {
+	if !self.debugInfo {
+		return
+	}
+
+	self.writeInt(len(sourceMap))
+
+	for _, entry := range sourceMap {
+		self.writeInt(entry.Offset)
+		self.writeInt(self.fileIndices[entry.Position.Filename])
+		self.writeInt(entry.Position.Offset)
+		self.writeInt(entry.Position.Line)
+		self.writeInt(entry.Position.Column)
+	}
+}
+
+func (self *encoder) writeConstant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		self.buffer.WriteByte(tagInteger)
+		self.buffer.Write(binary.AppendVarint(nil, constant.Value))
+	case *object.Float:
+		self.buffer.WriteByte(tagFloat)
+		self.buffer.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(constant.Value)))
+	case *object.String:
+		self.buffer.WriteByte(tagString)
+		self.writeString(constant.Value)
+	case *object.CompiledFunction:
+		self.buffer.WriteByte(tagFunction)
+
+		if self.debugInfo {
+			self.writeString(constant.Name)
+			self.writeStrings(constant.LocalNames)
+			self.writeStrings(constant.FreeNames)
+			self.writeSourceMap(constant.SourceMap)
+		}
+
+		self.writeInt(constant.NumberOfLocals)
+		self.writeInt(constant.NumberOfParameters)
+		self.writeInstructions(constant.Instructions)
+	default:
+		return fmt.Errorf("cannot marshal constant of type %s", constant.Type())
+	}
+
+	return nil
+}
+
+// decoder stops at the first error, every read after it returns a zero value
+type decoder struct {
+	data      []byte
+	offset    int
+	debugInfo bool
+	files     []string
+	err       error
+}
+
+func (self *decoder) fail(format string, a ...any) {
+	if self.err == nil {
+		self.err = fmt.Errorf("malformed bytecode: "+format, a...)
+	}
+}
+
+func (self *decoder) readInt() int {
+	if self.err != nil {
+		return 0
+	}
+
+	value, read := binary.Uvarint(self.data[self.offset:])
+
+	if read <= 0 || value > math.MaxInt32 {
+		self.fail("bad integer at offset %d", self.offset)
+		return 0
+	}
+
+	self.offset += read
+
+	return int(value)
+}
+
+func (self *decoder) readBytes(length int) []byte {
+	if self.err != nil {
+		return nil
+	}
+
+	if length > len(self.data)-self.offset {
+		self.fail("unexpected end of data at offset %d", self.offset)
+		return nil
+	}
+
+	value := self.data[self.offset : self.offset+length]
+	self.offset += length
+
+	return value
+}
+
+func (self *decoder) readString() string {
+	return string(self.readBytes(self.readInt()))
+}
+
+func (self *decoder) readStrings() []string {
+	length := self.readInt()
+
+	// every string takes at least a byte, a larger count is corrupt and must not allocate
+	if length > len(self.data)-self.offset {
+		self.fail("unexpected end of data at offset %d", self.offset)
+		return nil
+	}
+
+	values := make([]string, length)
+
+	for i := range values {
+		values[i] = self.readString()
+	}
+
+	return values
+}
+
+func (self *decoder) readInstructions() code.Instructions {
+	instructions := self.readBytes(self.readInt())
+
+	// a copy, the instructions must not alias the data they were read from
+	return append(code.Instructions{}, instructions...)
+}
+
+func (self *decoder) readFiles() {
+	numberOfFiles := self.readInt()
+
+	for i := 0; i < numberOfFiles && self.err == nil; i++ {
+		self.files = append(self.files, self.readString())
+	}
+}
+
+func (self *decoder) readSourceMap() code.SourceMap {
+	if !self.debugInfo {
+		return nil
+	}
+
+	var sourceMap code.SourceMap
+	numberOfEntries := self.readInt()
+
+	for i := 0; i < numberOfEntries && self.err == nil; i++ {
+		offset := self.readInt()
+		fileIndex := self.readInt()
+
+		if fileIndex >= len(self.files) {
+			self.fail("file index %d out of range", fileIndex)
+			return nil
+		}
+
+		position := token.Position{Filename: self.files[fileIndex]}
+		position.Offset = self.readInt()
+		position.Line = self.readInt()
+		position.Column = self.readInt()
+
+		sourceMap = append(sourceMap, code.SourceMapEntry{Offset: offset, Position: position})
+	}
+
+	return sourceMap
+}
+
+func (self *decoder) readConstant() object.Object {
+	tag := self.readBytes(1)
+
+	if tag == nil {
+		return nil
+	}
+
+	switch tag[0] {
+	case tagInteger:
+		value, read := binary.Varint(self.data[self.offset:])
+
+		if read <= 0 {
+			self.fail("bad integer at offset %d", self.offset)
+			return nil
+		}
+
+		self.offset += read
+
+		return &object.Integer{Value: value}
+	case tagFloat:
+		bits := self.readBytes(8)
+
+		if bits == nil {
+			return nil
+		}
+
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(bits))}
+	case tagString:
+		return &object.String{Value: self.readString()}
+	case tagFunction:
+		fn := &object.CompiledFunction{}
+
+		if self.debugInfo {
+			fn.Name = self.readString()
+			fn.LocalNames = self.readStrings()
+			fn.FreeNames = self.readStrings()
+			fn.SourceMap = self.readSourceMap()
+		}
+
+		fn.NumberOfLocals = self.readInt()
+		fn.NumberOfParameters = self.readInt()
+		fn.Instructions = self.readInstructions()
+
+		return fn
+	default:
+		self.fail("unknown constant tag %d at offset %d", tag[0], self.offset-1)
+		return nil
+	}
+}
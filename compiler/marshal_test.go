@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"errors"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compileFile(t *testing.T, filename string, input string) *ByteCode {
+	t.Helper()
+
+	program := parser.New(lexer.NewWithFilename(filename, input)).ParseProgram()
+
+	myCompiler := New()
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return myCompiler.ByteCode()
+}
+
+const marshalInput = `let greeting = "hello";
+let ratio = 1.5;
+let adder = fn(a) {
+	let make = fn(b) { a + b - 12345678901 };
+	make
+};
+adder(-3)(4);`
+
+func TestMarshalRoundTrip(t *testing.T) {
+	bytecode := compileFile(t, "main.monkey", marshalInput)
+
+	data, err := Marshal(bytecode, true)
+
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	if !strings.HasPrefix(string(data), formatMagic) {
+		t.Errorf("missing magic header. got = %q", data[:4])
+	}
+
+	decoded, err := Unmarshal(data)
+
+	if err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, bytecode) {
+		t.Errorf("round trip changed the bytecode.\nwant = %#v\ngot = %#v", bytecode, decoded)
+	}
+}
+
+func TestMarshalWithoutDebugInfo(t *testing.T) {
+	bytecode := compileFile(t, "main.monkey", marshalInput)
+
+	withDebugInfo, _ := Marshal(bytecode, true)
+
+	data, err := Marshal(bytecode, false)
+
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	if len(data) >= len(withDebugInfo) {
+		t.Errorf("debug info was not left out. %d bytes with it, %d without", len(withDebugInfo), len(data))
+	}
+
+	decoded, err := Unmarshal(data)
+
+	if err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	if decoded.SourceMap != nil || decoded.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong main program. got = %#v", decoded)
+	}
+
+	for i, constant := range decoded.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+
+		if !ok {
+			if constant.Inspect() != bytecode.Constants[i].Inspect() {
+				t.Errorf("constant %d: want = %s, got = %s", i, bytecode.Constants[i].Inspect(), constant.Inspect())
+			}
+			continue
+		}
+
+		original := bytecode.Constants[i].(*object.CompiledFunction)
+
+		if fn.Name != "" || fn.SourceMap != nil {
+			t.Errorf("constant %d: debug info was kept", i)
+		}
+
+		if fn.NumberOfLocals != original.NumberOfLocals || fn.NumberOfParameters != original.NumberOfParameters ||
+			fn.Instructions.String() != original.Instructions.String() {
+			t.Errorf("constant %d: wrong function. want = %#v, got = %#v", i, original, fn)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	data, err := Marshal(compileFile(t, "main.monkey", marshalInput), true)
+
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	corrupt := func(index int, value byte) []byte {
+		corrupted := append([]byte{}, data...)
+		corrupted[index] = value
+		return corrupted
+	}
+
+	tableTests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", nil, ErrInvalidMagic},
+		{"magic", corrupt(0, 'X'), ErrInvalidMagic},
+		{"version", corrupt(5, FormatVersion+1), ErrUnsupportedVersion},
+		{"flipped byte", corrupt(len(data)/2, data[len(data)/2]^0xff), ErrChecksumMismatch},
+		{"truncated", data[:len(data)-1], ErrChecksumMismatch},
+	}
+
+	for _, tt := range tableTests {
+		_, err := Unmarshal(tt.data)
+
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: wrong error. want = %q, got = %v", tt.name, tt.expected, err)
+		}
+	}
+
+	_, err = Marshal(&ByteCode{Constants: []object.Object{&object.Boolean{Value: true}}}, false)
+
+	if err == nil {
+		t.Errorf("expected an error marshalling a boolean constant")
+	}
+}
@@ -21,6 +21,7 @@ type SymbolTable struct {
 
 	store               map[string]Symbol
 	numberOfDefinitions int
+	definitionNames     []string // by index, a redefinition shadows a name but keeps its slot
 	FreeSymbols         []Symbol
 }
 
@@ -45,10 +46,16 @@ func (self *SymbolTable) Define(name string) Symbol {
 	self.store[name] = symbol
 
 	self.numberOfDefinitions++
+	self.definitionNames = append(self.definitionNames, name)
 
 	return symbol
 }
 
+// DefinitionNames returns the name of every global or local slot, in index order
+func (self *SymbolTable) DefinitionNames() []string {
+	return append([]string{}, self.definitionNames...)
+}
+
 func (self *SymbolTable) Resolve(name string) (Symbol, bool) {
 	symbol, ok := self.store[name]
 
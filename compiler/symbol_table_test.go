@@ -356,3 +356,40 @@ func TestShadowingFunctionName(t *testing.T) {
 	}
 
 }
+
+func TestDefinitionNames(t *testing.T) {
+
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+	global.Define("b")
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+	local.Define("c")
+	local.Resolve("a")
+
+	tableTests := []struct {
+		table    *SymbolTable
+		expected []string
+	}{
+		{global, []string{"a", "b", "a"}},
+		{local, []string{"c"}},
+	}
+
+	for _, tt := range tableTests {
+		names := tt.table.DefinitionNames()
+
+		if len(names) != len(tt.expected) {
+			t.Fatalf("wrong number of names. want = %v, got = %v", tt.expected, names)
+		}
+
+		for i, name := range tt.expected {
+			if names[i] != name {
+				t.Errorf("wrong name at %d. want = %q, got = %q", i, name, names[i])
+			}
+		}
+	}
+
+}
@@ -0,0 +1,64 @@
+package compiler
+
+import "github.com/Neal-C/compiler-in-go/ast"
+
+// findTailCalls returns the calls in tail position of a function body: the value of a return statement,
+// the last expression of the body and, through if/else, the last expression of each branch.
+// The result of such a call is the result of the function, so the VM can run it in the frame of the caller.
+func findTailCalls(body *ast.BlockStatement) map[*ast.CallExpression]bool {
+	tailCalls := make(map[*ast.CallExpression]bool)
+
+	markReturnValues(body, tailCalls)
+	markTailBlock(body, tailCalls)
+
+	return tailCalls
+}
+
+func markTailBlock(block *ast.BlockStatement, tailCalls map[*ast.CallExpression]bool) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+
+	if statement, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		markTailExpression(statement.Expression, tailCalls)
+	}
+}
+
+func markTailExpression(expression ast.Expression, tailCalls map[*ast.CallExpression]bool) {
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		tailCalls[expression] = true
+	case *ast.IfExpression:
+		markTailBlock(expression.Consequence, tailCalls)
+		markTailBlock(expression.Alternative, tailCalls)
+	}
+}
+
+// markReturnValues finds the return statements of the function, nested functions have their own
+func markReturnValues(block *ast.BlockStatement, tailCalls map[*ast.CallExpression]bool) {
+	if block == nil {
+		return
+	}
+
+	for _, statement := range block.Statements {
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(statement.ReturnValue, tailCalls)
+		case *ast.ExpressionStatement:
+			markReturnValuesInBranches(statement.Expression, tailCalls)
+		case *ast.LetStatement:
+			markReturnValuesInBranches(statement.Value, tailCalls)
+		case *ast.WhileStatement:
+			markReturnValues(statement.Body, tailCalls)
+		case *ast.ForStatement:
+			markReturnValues(statement.Body, tailCalls)
+		}
+	}
+}
+
+func markReturnValuesInBranches(expression ast.Expression, tailCalls map[*ast.CallExpression]bool) {
+	if ifExpression, ok := expression.(*ast.IfExpression); ok {
+		markReturnValues(ifExpression.Consequence, tailCalls)
+		markReturnValues(ifExpression.Alternative, tailCalls)
+	}
+}
@@ -0,0 +1,218 @@
+// Package disassembler prints compiled bytecode for humans: constants are inlined, jump targets labelled,
+// and variables named when the bytecode carries debug info.
+package disassembler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/object"
+	"sort"
+)
+
+// annotationColumn is where the comment after an instruction starts
+const annotationColumn = 24
+
+// Disassemble lists the main program, then every compiled function of the constant pool,
+// each one after the function that creates it:
+//
+//	== main ==
+//	0000 OpClosure 1 0      ; fn countDown
+//	0004 OpSetGlobal 0      ; countDown
+//
+//	== constant 1: fn countDown, 1 parameter, 1 local ==
+//	0000 OpGetLocal 0       ; x
+//	0002 OpJumpNotTruthy 8  ; L1
+//	...
+//	L1:
+//	0008 OpNull
+func Disassemble(bytecode *compiler.ByteCode) string {
+	disassembler := &disassembler{bytecode: bytecode, visited: make(map[int]bool)}
+
+	disassembler.out.WriteString("== main ==\n")
+	disassembler.function(bytecode.Instructions, &object.CompiledFunction{}, true)
+
+	// functions no closure of the program creates, left behind by the REPL or an optimizer
+	for index := range bytecode.Constants {
+		disassembler.constant(index)
+	}
+
+	return disassembler.out.String()
+}
+
+type disassembler struct {
+	bytecode *compiler.ByteCode
+	out      bytes.Buffer
+	visited  map[int]bool // function constants already listed
+}
+
+// constant lists the function at index in the constant pool, and the functions it creates
+func (self *disassembler) constant(index int) {
+	fn, ok := self.bytecode.Constants[index].(*object.CompiledFunction)
+
+	if !ok || self.visited[index] {
+		return
+	}
+
+	self.visited[index] = true
+
+	fmt.Fprintf(&self.out, "\n== constant %d: %s, %s, %s ==\n", index, functionName(fn),
+		plural(fn.NumberOfParameters, "parameter"), plural(fn.NumberOfLocals, "local"))
+
+	self.function(fn.Instructions, fn, false)
+}
+
+func (self *disassembler) function(instructions code.Instructions, fn *object.CompiledFunction, isMain bool) {
+	labels := jumpLabels(instructions)
+	var closures []int
+
+	for offset := 0; offset < len(instructions); {
+		definition, err := code.LookUp(instructions[offset])
+
+		if err != nil {
+			fmt.Fprintf(&self.out, "%04d ERROR: %s\n", offset, err)
+			offset++
+			continue
+		}
+
+		if offset+definition.Width() > len(instructions) {
+			fmt.Fprintf(&self.out, "%04d ERROR: %s is missing operands\n", offset, definition.Name)
+			break
+		}
+
+		if label, ok := labels[offset]; ok {
+			fmt.Fprintf(&self.out, "%s:\n", label)
+		}
+
+		op := code.Opcode(instructions[offset])
+		operands, read := code.ReadOperands(definition, instructions[offset+1:])
+
+		line := fmt.Sprintf("%04d %s", offset, definition.Format(operands))
+
+		if annotation := self.annotate(op, operands, fn, isMain, labels); annotation != "" {
+			line = fmt.Sprintf("%-*s ; %s", annotationColumn-1, line, annotation)
+		}
+
+		self.out.WriteString(line + "\n")
+
+		if op == code.OpClosure {
+			closures = append(closures, operands[0])
+		}
+
+		offset += 1 + read
+	}
+
+	// a jump past the last instruction, out of a loop that ends the function
+	if label, ok := labels[len(instructions)]; ok {
+		fmt.Fprintf(&self.out, "%s:\n", label)
+	}
+
+	for _, index := range closures {
+		if index < len(self.bytecode.Constants) {
+			self.constant(index)
+		}
+	}
+}
+
+func (self *disassembler) annotate(op code.Opcode, operands []int, fn *object.CompiledFunction, isMain bool, labels map[int]string) string {
+	switch op {
+	case code.OpConstant, code.OpClosure:
+		return self.constantValue(operands[0])
+	case code.OpJump, code.OpJumpNotTruthy:
+		return labels[operands[0]]
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return name(self.bytecode.GlobalNames, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCell:
+		return name(fn.LocalNames, operands[0])
+	case code.OpGetFree, code.OpSetFree, code.OpGetFreeCell:
+		return name(fn.FreeNames, operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpCurrentClosure:
+		if !isMain {
+			return functionName(fn)
+		}
+	}
+
+	return ""
+}
+
+// constantValue is a constant the way it reads in source, functions by name
+func (self *disassembler) constantValue(index int) string {
+	if index >= len(self.bytecode.Constants) {
+		return "constant out of range"
+	}
+
+	switch constant := self.bytecode.Constants[index].(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", constant.Value)
+	case *object.CompiledFunction:
+		return functionName(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+// jumpLabels names the jump targets L1, L2, ... by increasing offset
+func jumpLabels(instructions code.Instructions) map[int]string {
+	var targets []int
+	seen := make(map[int]bool)
+
+	for offset := 0; offset < len(instructions); {
+		definition, err := code.LookUp(instructions[offset])
+
+		if err != nil || offset+definition.Width() > len(instructions) {
+			break
+		}
+
+		op := code.Opcode(instructions[offset])
+
+		if op == code.OpJump || op == code.OpJumpNotTruthy {
+			target := int(code.ReadUint16(instructions[offset+1:]))
+
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+
+		offset += definition.Width()
+	}
+
+	sort.Ints(targets)
+
+	labels := make(map[int]string, len(targets))
+
+	for index, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", index+1)
+	}
+
+	return labels
+}
+
+func name(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+
+	return ""
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "fn <anonymous>"
+	}
+
+	return "fn " + fn.Name
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+
+	return fmt.Sprintf("%d %ss", count, noun)
+}
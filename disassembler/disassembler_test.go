@@ -0,0 +1,97 @@
+package disassembler
+
+import (
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *compiler.ByteCode {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return myCompiler.ByteCode()
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `let greeting = "hi";
+let adder = fn(a) { fn(b) { if (b) { a } else { len(greeting) } } };
+adder(1)(2);`
+
+	expected := `== main ==
+0000 OpConstant 0       ; "hi"
+0003 OpSetGlobal 0      ; greeting
+0006 OpClosure 2 0      ; fn adder
+0010 OpSetGlobal 1      ; adder
+0013 OpGetGlobal 1      ; adder
+0016 OpConstant 3       ; 1
+0019 OpCall 1
+0021 OpConstant 4       ; 2
+0024 OpCall 1
+0026 OpPop
+
+== constant 2: fn adder, 1 parameter, 1 local ==
+0000 OpGetLocalCell 0   ; a
+0002 OpClosure 1 1      ; fn <anonymous>
+0006 OpReturnValue
+
+== constant 1: fn <anonymous>, 1 parameter, 1 local ==
+0000 OpGetLocal 0       ; b
+0002 OpJumpNotTruthy 10 ; L1
+0005 OpGetFree 0        ; a
+0007 OpJump 17          ; L2
+L1:
+0010 OpGetBuiltin 0     ; len
+0012 OpGetGlobal 0      ; greeting
+0015 OpTailCall 1
+L2:
+0017 OpReturnValue
+`
+
+	actual := Disassemble(compile(t, input))
+
+	if actual != expected {
+		t.Errorf("wrong disassembly.\nwant =\n%s\ngot =\n%s", expected, actual)
+	}
+}
+
+func TestDisassembleWithoutDebugInfo(t *testing.T) {
+	fn := &object.CompiledFunction{
+		Instructions:   append(append(code.Make(code.OpGetLocal, 0), code.Make(code.OpJump, 5)...), code.Make(code.OpReturnValue)...),
+		NumberOfLocals: 1,
+	}
+
+	bytecode := &compiler.ByteCode{
+		Instructions: append(append(code.Make(code.OpConstant, 1), code.Make(code.OpSetGlobal, 0)...), 255),
+		Constants:    []object.Object{fn, &object.Float{Value: 1.5}},
+	}
+
+	expected := `== main ==
+0000 OpConstant 1       ; 1.5
+0003 OpSetGlobal 0
+0006 ERROR: opcode 255 undefined
+
+== constant 0: fn <anonymous>, 0 parameters, 1 local ==
+0000 OpGetLocal 0
+0002 OpJump 5           ; L1
+L1:
+0005 OpReturnValue
+`
+
+	actual := Disassemble(bytecode)
+
+	if actual != expected {
+		t.Errorf("wrong disassembly.\nwant =\n%s\ngot =\n%s", expected, actual)
+	}
+}
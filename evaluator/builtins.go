@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"errors"
 	"github.com/Neal-C/compiler-in-go/object"
 )
 
@@ -11,4 +12,29 @@ var builtins = map[string]*object.Builtin{
 	"rest":  object.GetBuiltinByName("rest"),
 	"push":  object.GetBuiltinByName("push"),
 	"puts":  object.GetBuiltinByName("puts"),
+	"int":   object.GetBuiltinByName("int"),
+	"float": object.GetBuiltinByName("float"),
+
+	"map":     object.GetBuiltinByName("map"),
+	"filter":  object.GetBuiltinByName("filter"),
+	"reduce":  object.GetBuiltinByName("reduce"),
+	"each":    object.GetBuiltinByName("each"),
+	"find":    object.GetBuiltinByName("find"),
+	"any":     object.GetBuiltinByName("any"),
+	"all":     object.GetBuiltinByName("all"),
+	"sort_by": object.GetBuiltinByName("sort_by"),
+}
+
+// caller lets builtins like map apply functions in the evaluator, see object.Caller
+type caller struct{}
+
+// Call turns the error a function evaluates to into the error of the call
+func (self caller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args)
+
+	if evaluationError, ok := result.(*object.Error); ok {
+		return nil, errors.New(evaluationError.Message)
+	}
+
+	return result, nil
 }
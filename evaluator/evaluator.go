@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"github.com/Neal-C/compiler-in-go/ast"
 	"github.com/Neal-C/compiler-in-go/object"
+	"math"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -20,6 +24,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeNodeToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
@@ -33,6 +39,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(leftHandSign) {
 			return leftHandSign
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, leftHandSign, env)
+		}
 		rightHandSign := Eval(node.Right, env)
 		if isError(rightHandSign) {
 			return rightHandSign
@@ -54,6 +63,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return value
 		}
 		env.Set(node.Name.Value, value)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
@@ -117,6 +136,10 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break:
+			return newError("break outside of a loop")
+		case *object.Continue:
+			return newError("continue outside of a loop")
 		}
 	}
 
@@ -156,6 +179,9 @@ func evalBangOperatorExpression(rightHandSign object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(rightHandSign object.Object) object.Object {
+	if float, ok := rightHandSign.(*object.Float); ok {
+		return &object.Float{Value: -float.Value}
+	}
 	if rightHandSign.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", rightHandSign.Type())
 	}
@@ -171,10 +197,12 @@ func evalInfixExpression(operator string, leftHandSign object.Object, rightHandS
 	switch {
 	case leftHandSign.Type() == object.INTEGER_OBJ && rightHandSign.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, leftHandSign, rightHandSign)
+	case object.IsNumber(leftHandSign) && object.IsNumber(rightHandSign):
+		return evalFloatInfixExpression(operator, leftHandSign, rightHandSign)
 	case operator == "==":
-		return nativeNodeToBooleanObject(leftHandSign == rightHandSign)
+		return nativeNodeToBooleanObject(object.Equal(leftHandSign, rightHandSign))
 	case operator == "!=":
-		return nativeNodeToBooleanObject(leftHandSign != rightHandSign)
+		return nativeNodeToBooleanObject(!object.Equal(leftHandSign, rightHandSign))
 	case leftHandSign.Type() != rightHandSign.Type():
 		return newError("type mismatch: %s %s %s", leftHandSign.Type(), operator, rightHandSign.Type())
 	case leftHandSign.Type() == object.STRING_OBJ && rightHandSign.Type() == object.STRING_OBJ:
@@ -197,11 +225,23 @@ func evalIntegerInfixExpression(operator string, leftHandSign object.Object, rig
 	case "*":
 		return &object.Integer{Value: leftValue * rightValue}
 	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftValue % rightValue}
 	case "<":
 		return nativeNodeToBooleanObject(leftValue < rightValue)
 	case ">":
 		return nativeNodeToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeNodeToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeNodeToBooleanObject(leftValue >= rightValue)
 	case "==":
 		return nativeNodeToBooleanObject(leftValue == rightValue)
 	case "!=":
@@ -211,6 +251,114 @@ func evalIntegerInfixExpression(operator string, leftHandSign object.Object, rig
 	}
 }
 
+// evalFloatInfixExpression handles floats, and integers mixed with floats
+func evalFloatInfixExpression(operator string, leftHandSign object.Object, rightHandSign object.Object) object.Object {
+	leftValue := object.ToFloat(leftHandSign)
+	rightValue := object.ToFloat(rightHandSign)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+	case "<":
+		return nativeNodeToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeNodeToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeNodeToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeNodeToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeNodeToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeNodeToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", leftHandSign.Type(), operator, rightHandSign.Type())
+	}
+}
+
+// evalLogicalExpression only evaluates the right operand when the left one does not decide the result,
+// the result is a boolean, the same as in the VM
+func evalLogicalExpression(node *ast.InfixExpression, leftHandSign object.Object, env *object.Environment) object.Object {
+	if node.Operator == "&&" && !isTruthy(leftHandSign) {
+		return FALSE
+	}
+
+	if node.Operator == "||" && isTruthy(leftHandSign) {
+		return TRUE
+	}
+
+	rightHandSign := Eval(node.Right, env)
+	if isError(rightHandSign) {
+		return rightHandSign
+	}
+
+	return nativeNodeToBooleanObject(isTruthy(rightHandSign))
+}
+
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, exit := evalLoopBody(node.Body, env); exit {
+			return result
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+
+	if isError(iterable) {
+		return iterable
+	}
+
+	items, ok := object.IterableItems(iterable)
+
+	if !ok {
+		return newError("cannot iterate over : %s", iterable.Type())
+	}
+
+	for _, item := range items {
+		env.Set(node.Variable.Value, item)
+
+		if result, exit := evalLoopBody(node.Body, env); exit {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// evalLoopBody runs one iteration, it reports whether the loop must stop and with which result
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+
+	switch result := result.(type) {
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	case *object.Break:
+		return NULL, true
+	default:
+		return nil, false
+	}
+}
+
 func evalIfExpression(ifExpr *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ifExpr.Condition, env)
 
@@ -248,7 +396,8 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
 
 		if result != nil {
 			resultType := result.Type()
-			if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ {
+			if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ ||
+				resultType == object.BREAK_OBJ || resultType == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -280,6 +429,109 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+// evalAssignExpression rebinds the variable where it was defined, so closures and enclosing scopes see the change
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return evalIndexAssignment(node, target, env)
+	}
+
+	target, ok := node.Target.(*ast.Identifier)
+
+	if !ok {
+		return newError("cannot assign to %s", node.Target.String())
+	}
+
+	// like the VM, a compound assignment reads the variable before evaluating the value
+	var current object.Object
+	if node.Operator != "=" {
+		current = evalIdentifier(target, env)
+		if isError(current) {
+			return current
+		}
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if current != nil {
+		value = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	if !env.Assign(target.Value, value) {
+		if _, ok := builtins[target.Value]; ok {
+			return newError("cannot assign to %s", target.Value)
+		}
+		return newError("identifier not found: " + target.Value)
+	}
+
+	return value
+}
+
+// evalIndexAssignment mutates the array or hash in place, every reference to it sees the change
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	index := Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if current != nil {
+		value = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+
+		if !ok {
+			return newError("array index must be an INTEGER, got: %s", index.Type())
+		}
+
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d (length %d)", idx.Value, len(left.Elements))
+		}
+
+		left.Elements[idx.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
 func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
@@ -302,18 +554,36 @@ func applyFunction(fnCall object.Object, args []object.Object) object.Object {
 
 	case *object.Function:
 
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+
 		extendedEnv := extendFunctionEnv(fn, args)
 
 		evaluated := Eval(fn.Body, extendedEnv)
 
+		switch evaluated.(type) {
+		case *object.Break:
+			return newError("break outside of a loop")
+		case *object.Continue:
+			return newError("continue outside of a loop")
+		}
+
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
 
-		if result := fn.Fn(args...); result != nil {
-			return result
+		result, err := fn.Call(caller{}, args...)
+
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		// a builtin with nothing to return, like puts, returns nil
+		if result == nil {
+			return NULL
 		}
 
-		return nil
+		return result
 
 	default:
 
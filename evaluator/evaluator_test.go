@@ -92,6 +92,51 @@ func TestEvalBooleanExpression(t *testing.T) {
 
 }
 
+// TestStructuralEquality has the same table as vm.TestStructuralEquality
+func TestStructuralEquality(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[] == []`, true},
+		{`[1, [2, "three"]] == [1, [2, "three"]]`, true},
+		{`[1, [2, "three"]] == [1, [2, "four"]]`, false},
+		{`[1] == [1.0]`, true},
+		{`[1] == ["1"]`, false},
+		{`[true] == [true]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{1: "one"} != {1: "one"}`, false},
+		{`[1] == {0: 1}`, false},
+		{`"1" == 1`, false},
+		{`let a = [1]; a[0] = a; a == a`, true},
+		{`let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b`, true},
+		{`let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a != b`, true},
+		{`let h = {"n": 1}; h["self"] = h; let g = {"n": 1}; g["self"] = g; h == g`, true},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`len == len`, true},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input: %s", tt.input)
+		}
+	}
+}
+
 func testBooleanObject(t *testing.T, evaluated object.Object, expected bool) bool {
 	result, ok := evaluated.(*object.Boolean)
 
@@ -347,6 +392,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to len not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`first([])`, nil},
+		{`let r = last([]); r`, nil},
 	}
 
 	for _, tt := range tableTests {
@@ -355,6 +402,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
 		case string:
 			errorObj, ok := evaluated.(*object.Error)
 
@@ -370,6 +419,55 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+// TestCallbackBuiltins runs the builtins that apply functions, vm.TestCallbackBuiltins has the same table
+func TestCallbackBuiltins(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected string // inspected
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, "[11, 12]"},
+		{`map(["a", "bb"], len)`, "[1, 2]"},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; map([3, 4], fact)`, "[6, 24]"},
+		{`map([[1, 2], [3]], fn(xs) { reduce(xs, 0, fn(a, b) { a + b }) })`, "[3, 3]"},
+		{`let double = fn(xs) { map(xs, fn(x) { x * 2 }) }; double([1, 2])`, "[2, 4]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`filter([0, 1, false, true], fn(x) { x })`, "[0, 1, true]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`let sum = 0; each([1, 2, 3], fn(x) { sum += x }); sum`, "6"},
+		{`each([1], fn(x) { x })`, "null"},
+		{`find([1, 5, 10], fn(x) { x > 3 })`, "5"},
+		{`find([1, 2], fn(x) { x > 3 })`, "null"},
+		{`any([1, 2], fn(x) { x > 1 })`, "true"},
+		{`any([], fn(x) { true })`, "false"},
+		{`all([1, 2], fn(x) { x > 0 })`, "true"},
+		{`all([], fn(x) { false })`, "true"},
+		{`!all([1, 2], fn(x) { x > 1 })`, "true"},
+		{`any([1], fn(x) { false }) == false`, "true"},
+		{`sort_by([3, 1, 2], fn(x) { x })`, "[1, 2, 3]"},
+		{`sort_by(["bb", "a", "ccc"], len)`, "[a, bb, ccc]"},
+		{`sort_by([2, 1.5, 1], fn(x) { x })`, "[1, 1.5, 2]"},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], fn(pair) { pair[0] })`, "[[1, b], [2, a], [2, c]]"},
+		{`map(1, fn(x) { x })`, "ERROR: first argument to map must be an ARRAY, got INTEGER"},
+		{`filter([1], 2)`, "ERROR: last argument to filter must be a function, got INTEGER"},
+		{`reduce([1], fn(a, b) { a })`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`sort_by([1, "a"], fn(x) { x })`, "ERROR: sort_by keys must all be numbers or all be strings, got INTEGER and STRING"},
+		{`map([1, 0], fn(x) { 1 / x })`, "ERROR: division by zero"},
+		{`map([1], fn(x, y) { x })`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`map([1, 2, 3], len)`, "ERROR: argument to len not supported, got INTEGER"},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected = %s, got = %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	input := `[1, 2 * 2, 3 + 3]`
 
@@ -516,3 +614,253 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func testFloatObject(t *testing.T, evaluated object.Object, expected float64) bool {
+	result, ok := evaluated.(*object.Float)
+
+	if !ok {
+		t.Errorf("object is not a Float, got %T (%+v)", evaluated, evaluated)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value, got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected any
+	}{
+		{"1.5", 1.5},
+		{"1e-9", 1e-9},
+		{"-0.5", -0.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"3 / 2.0", 1.5},
+		{"2.5 * 2", 5.0},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"1 == 1.0", true},
+		{"float(3) / 2", 1.5},
+		{"int(2.9)", 2},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"7 % 3", 1},
+		{"7.5 % 2", 1.5},
+		{"true && false", false},
+		{"1 && 2", true},
+		{"false || true", true},
+		{"false || false", false},
+		{"let boom = fn() { 1 + true }; true || boom()", true},
+		{"let boom = fn() { 1 + true }; false && boom()", false},
+		{"true && 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"1 % 0", "division by zero"},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+
+			if !ok {
+				t.Errorf("no error object returned, got = %T (%v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, exepcted = %q, got = %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected any
+	}{
+		{`let f = fn(items) { for (x in items) { if (x > 2) { return x; } } }; f([1, 2, 3, 4])`, 3},
+		{`let f = fn() { for (k in {"b": 1, "a": 2}) { return k; } }; f()`, "a"},
+		{`let f = fn() { for (c in "monkey") { return c; } }; f()`, "m"},
+		{`let f = fn() { for (x in [1, 2, 3, 4]) { if (x < 3) { continue; } return x; } }; f()`, 3},
+		{`let f = fn() { for (x in [1, 2, 3]) { break; return x; }; 99 }; f()`, 99},
+		{`let f = fn() { for (x in [1, 2, 3]) { for (y in [4, 5, 6]) { if (y > 4) { break; } if (x > 1) { return x * y; } } } }; f()`, 8},
+		{`let f = fn() { while (true) { return 7; } }; f()`, 7},
+		{`let f = fn() { while (true) { break; }; 5 }; f()`, 5},
+		{`let f = fn() { for (x in []) { } }; f()`, nil},
+		{`for (x in [1, 2, 3]) { let y = x * 10; }; x + y`, 33},
+		// a loop leaves null, vm.TestLoops has the same cases
+		{`for (x in [1]) { }`, nil},
+		{`while (false) { }`, nil},
+		{`let i = 0; while (i < 2) { i += 1 }`, nil},
+		{`while (true) { break; }`, nil},
+		{`break;`, errorMessage("break outside of a loop")},
+		{`let f = fn() { continue; }; while (true) { f(); }`, errorMessage("continue outside of a loop")},
+		{`for (x in 1) { }`, errorMessage("cannot iterate over : INTEGER")},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not a String, got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("str.Value has wrong value, got = %q, wanted = %q", str.Value, expected)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned, got = %T (%v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message, exepcted = %q, got = %q", expected, errObj.Message)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+type errorMessage string
+
+func TestAssignments(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected any
+	}{
+		{`let x = 1; x = 2; x`, 2},
+		{`let x = 1; x = x + 1`, 2},
+		{`let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x`, 6},
+		{`let x = 1.5; x *= 2; x`, 3.0},
+		{`let s = "mon"; s += "key"; s`, "monkey"},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let x = 1; let y = (x = 5) + 1; x * y`, 30},
+		{`let f = fn(x) { x += 1; x }; f(1)`, 2},
+		{`let count = 0; let inc = fn() { count += 1 }; inc(); inc(); count`, 2},
+		{`let f = fn() { let x = 1; let set = fn(v) { x = v }; set(7); x }; f()`, 7},
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()`, 3},
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()`, 1},
+		{`let f = fn() { let x = 1; let get = fn() { x }; x = 2; get() }; f()`, 2},
+		{`let f = fn() { let x = 0; let g = fn() { fn() { x += 10 } }; g()(); g()(); x }; f()`, 20},
+		{`let i = 0; let sum = 0; while (i < 5) { sum += i; i += 1; }; sum`, 10},
+		{`let sum = 0; for (x in [1, 2, 3]) { sum += x; }; sum`, 6},
+		{`let f = fn() { let n = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } n += x; }; n }; f()`, 4},
+		{`let i = 0; while (true) { i += 1; if (i > 2) { break; } }; i`, 3},
+		{`let i = 0; while (i < 5000) { i += 1; }; i`, 5000},
+		{`x = 1`, errorMessage("identifier not found: x")},
+		{`len = 1`, errorMessage("cannot assign to len")},
+		{`let x = 1; x += true`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not a String, got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("str.Value has wrong value, got = %q, wanted = %q", str.Value, expected)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned, got = %T (%v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message, exepcted = %q, got = %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected any
+	}{
+		{`let a = [1]; let b = a; b[0] = 2; a[0]`, 2},
+		{`let a = [0, 0]; let x = a[1] = 7; x + a[1]`, 14},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]`, 3},
+		{`let h = {"n": 1}; let calls = 0; let key = fn() { calls += 1; "n" }; h[key()] += 1; h["n"] * 10 + calls`, 21},
+		{`let counts = {}; for (c in "abca") { if (!counts[c]) { counts[c] = 0; } counts[c] += 1; }; counts["a"]`, 2},
+		{`let a = [1, 2, 3]; a[0] += 10; a[2] *= a[0]; a[0] + a[1] + a[2]`, 46},
+		{`let a = [1]; a[1] = 2`, errorMessage("index out of range: 1 (length 1)")},
+		{`let a = [1]; a[-1] = 2`, errorMessage("index out of range: -1 (length 1)")},
+		{`let a = [1]; a["x"] = 2`, errorMessage("array index must be an INTEGER, got: STRING")},
+		{`let h = {}; h[[1]] = 2`, errorMessage("unusable as hash key: ARRAY")},
+		{`let s = "abc"; s[0] = "x"`, errorMessage("index assignment not supported: STRING")},
+	}
+
+	for _, tt := range tableTests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned, got = %T (%v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message, exepcted = %q, got = %q", expected, errObj.Message)
+			}
+		}
+	}
+}
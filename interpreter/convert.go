@@ -0,0 +1,183 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/vm"
+	"reflect"
+)
+
+// ErrCycle is returned by ToGo for an array or a hash that contains itself
+var ErrCycle = errors.New("cannot convert a value that contains itself")
+
+// FromGo converts a Go value to the object the VM uses for it:
+//   - nil to null, bool to the VM's true and false, so that ! and == work on them
+//   - signed and unsigned integers to INTEGER, floats to FLOAT, string to STRING
+//   - slices and arrays to ARRAY, maps to HASH, their keys must be booleans, numbers or strings
+//   - a func(...object.Object) object.Object to a builtin
+//
+// An object.Object is returned as is.
+func FromGo(value any) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return vm.Null, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return vm.True, nil
+		}
+		return vm.False, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case func(args ...object.Object) object.Object:
+		return &object.Builtin{Fn: value}, nil
+	case object.BuiltinFunction:
+		return &object.Builtin{Fn: value}, nil
+	}
+
+	reflected := reflect.ValueOf(value)
+
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: reflected.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &object.Integer{Value: int64(reflected.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: reflected.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: reflected.String()}, nil
+	case reflect.Bool:
+		return FromGo(reflected.Bool())
+	case reflect.Pointer, reflect.Interface:
+		if reflected.IsNil() {
+			return vm.Null, nil
+		}
+		return FromGo(reflected.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, reflected.Len())
+
+		for index := range elements {
+			element, err := FromGo(reflected.Index(index).Interface())
+
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", index, err)
+			}
+
+			elements[index] = element
+		}
+
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair, reflected.Len())
+
+		iterator := reflected.MapRange()
+
+		for iterator.Next() {
+			key, err := FromGo(iterator.Key().Interface())
+
+			if err != nil {
+				return nil, err
+			}
+
+			hashable, ok := key.(object.Hashable)
+
+			if !ok {
+				return nil, fmt.Errorf("unusable as a hash key: %s", key.Type())
+			}
+
+			element, err := FromGo(iterator.Value().Interface())
+
+			if err != nil {
+				return nil, fmt.Errorf("value of %s: %w", key.Inspect(), err)
+			}
+
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: element}
+		}
+
+		return &object.Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a monkey object", value)
+	}
+}
+
+// ToGo converts an object to a plain Go value:
+//   - null to nil, BOOLEAN to bool, INTEGER to int64, FLOAT to float64, STRING to string
+//   - ARRAY to []any, HASH to map[any]any, keyed by the converted keys
+//   - an ERROR to an error carrying its message
+//
+// Functions, closures and builtins are returned as is, for Interpreter.Call.
+func ToGo(obj object.Object) (any, error) {
+	return toGo(obj, make(map[object.Object]bool))
+}
+
+// visiting holds the arrays and hashes being converted, one of them showing up again is a cycle
+func toGo(obj object.Object, visiting map[object.Object]bool) (any, error) {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Error:
+		return nil, errors.New(obj.Message)
+	case *object.Array:
+		if visiting[obj] {
+			return nil, ErrCycle
+		}
+
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]any, len(obj.Elements))
+
+		for index, element := range obj.Elements {
+			converted, err := toGo(element, visiting)
+
+			if err != nil {
+				return nil, err
+			}
+
+			elements[index] = converted
+		}
+
+		return elements, nil
+	case *object.Hash:
+		if visiting[obj] {
+			return nil, ErrCycle
+		}
+
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		pairs := make(map[any]any, len(obj.Pairs))
+
+		for _, pair := range obj.Pairs {
+			key, err := toGo(pair.Key, visiting)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := toGo(pair.Value, visiting)
+
+			if err != nil {
+				return nil, err
+			}
+
+			pairs[key] = value
+		}
+
+		return pairs, nil
+	case *object.Closure, *object.Builtin, *object.Function, *object.CompiledFunction:
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
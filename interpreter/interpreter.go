@@ -0,0 +1,174 @@
+// Package interpreter embeds Monkey in a Go program: it runs source against globals that outlive every run,
+// exposes Go functions to the program, and calls back the functions the program defines.
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/optimizer"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"github.com/Neal-C/compiler-in-go/vm"
+	"strings"
+)
+
+// ParseError is returned by Run for source that does not parse, with every syntax error found
+type ParseError struct {
+	Messages []string
+}
+
+func (self *ParseError) Error() string {
+	return "parse error: " + strings.Join(self.Messages, "; ")
+}
+
+// ErrNotGlobal is returned by GetGlobal for a name the program and the host never defined
+var ErrNotGlobal = errors.New("no such global")
+
+// Options tune every run and every call of an Interpreter
+type Options struct {
+	Optimize bool       // run the peephole optimizer over the bytecode
+	VM       vm.Options // limits of the VM, its Globals are the ones of the interpreter
+}
+
+// Interpreter keeps what one run leaves for the next, the way the REPL does:
+// the symbol table naming the globals, the constant pool and the global store.
+type Interpreter struct {
+	options     Options
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func New() *Interpreter {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(options Options) *Interpreter {
+	symbolTable := compiler.NewSymbolTable()
+
+	for index, definition := range object.Builtins {
+		symbolTable.DefineBuiltin(index, definition.Name)
+	}
+
+	return &Interpreter{
+		options:     options,
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     []object.Object{},
+	}
+}
+
+// Register exposes fn to the programs run afterwards as the global name, it shadows a builtin of the same name.
+// Like a builtin, fn reports a failure by returning an *object.Error.
+func (self *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	self.SetGlobal(name, &object.Builtin{Fn: fn})
+}
+
+// RegisterCallback is Register for a host function that calls back the functions it is given, like map does
+func (self *Interpreter) RegisterCallback(name string, fn object.CallbackFunction) {
+	self.SetGlobal(name, &object.Builtin{CallbackFn: fn})
+}
+
+// SetGlobal assigns the global name, defining it for the programs run afterwards when it is new
+func (self *Interpreter) SetGlobal(name string, value object.Object) {
+	symbol, ok := self.symbolTable.Resolve(name)
+
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = self.symbolTable.Define(name)
+	}
+
+	if symbol.Index >= len(self.globals) {
+		globals := make([]object.Object, symbol.Index+1)
+		copy(globals, self.globals)
+		self.globals = globals
+	}
+
+	self.globals[symbol.Index] = value
+}
+
+// GetGlobal is the value of the global name, as the last run or SetGlobal left it
+func (self *Interpreter) GetGlobal(name string) (object.Object, error) {
+	symbol, ok := self.symbolTable.Resolve(name)
+
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, fmt.Errorf("%w: %s", ErrNotGlobal, name)
+	}
+
+	if symbol.Index >= len(self.globals) || self.globals[symbol.Index] == nil {
+		return vm.Null, nil
+	}
+
+	return self.globals[symbol.Index], nil
+}
+
+// Run compiles and runs source, it returns the last value the program popped off the stack,
+// the value of its last expression statement when it ends with one.
+// Failures are a *ParseError, a compilation error or a *vm.RuntimeError.
+func (self *Interpreter) Run(source string) (object.Object, error) {
+	return self.RunContext(context.Background(), source)
+}
+
+// RunContext is Run, stopping with a *vm.RuntimeError wrapping ctx.Err() once ctx is done
+func (self *Interpreter) RunContext(ctx context.Context, source string) (object.Object, error) {
+	monkeyParser := parser.New(lexer.New(source))
+	program := monkeyParser.ParseProgram()
+
+	if len(monkeyParser.Errors()) != 0 {
+		return nil, &ParseError{Messages: monkeyParser.Errors()}
+	}
+
+	myCompiler := compiler.NewWithState(self.symbolTable, self.constants)
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bytecode := myCompiler.ByteCode()
+	self.constants = bytecode.Constants
+
+	if self.options.Optimize {
+		bytecode = optimizer.Optimize(bytecode)
+	}
+
+	machine := self.newVM(bytecode)
+
+	err = machine.RunContext(ctx)
+
+	// the store grows with the globals the program defines
+	self.globals = machine.Globals()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return machine.LastPoppedStackElement(), nil
+}
+
+// Call applies fn, a closure the program handed over or a builtin, to args
+func (self *Interpreter) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return self.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is Call, stopping with a *vm.RuntimeError wrapping ctx.Err() once ctx is done
+func (self *Interpreter) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	machine := self.newVM(&compiler.ByteCode{Constants: self.constants})
+
+	result, err := machine.CallContext(ctx, fn, args...)
+
+	// the function may assign globals
+	self.globals = machine.Globals()
+
+	return result, err
+}
+
+func (self *Interpreter) newVM(bytecode *compiler.ByteCode) *vm.VM {
+	options := self.options.VM
+	options.Globals = self.globals
+
+	return vm.NewWithOptions(bytecode, options)
+}
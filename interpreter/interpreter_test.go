@@ -0,0 +1,355 @@
+package interpreter
+
+import (
+	"errors"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/vm"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunKeepsGlobals(t *testing.T) {
+	monkey := New()
+
+	steps := []struct {
+		source   string
+		expected any
+	}{
+		{"let a = 1;", int64(1)},
+		{"let b = a + 1; b", int64(2)},
+		{"a = a * 10; a + b", int64(12)},
+		{`let greet = fn(name) { "hello " + name }; greet("monkey")`, "hello monkey"},
+	}
+
+	for _, step := range steps {
+		result, err := monkey.Run(step.source)
+
+		if err != nil {
+			t.Fatalf("%q: %s", step.source, err)
+		}
+
+		converted, err := ToGo(result)
+
+		if err != nil {
+			t.Fatalf("%q: %s", step.source, err)
+		}
+
+		if converted != step.expected {
+			t.Errorf("%q: got %v, want %v", step.source, converted, step.expected)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	monkey := New()
+
+	_, err := monkey.Run("let = 1;")
+
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Errorf("expected a *ParseError, got %T (%v)", err, err)
+	}
+
+	_, err = monkey.Run("undefined + 1")
+
+	if err == nil || !strings.Contains(err.Error(), "undefined variable") {
+		t.Errorf("expected a compilation error, got %v", err)
+	}
+
+	_, err = monkey.Run("1 / 0")
+
+	var runtimeError *vm.RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Errorf("expected a *vm.RuntimeError, got %T (%v)", err, err)
+	}
+
+	// a failed run leaves the interpreter usable
+	result, err := monkey.Run("40 + 2")
+
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("expected 42, got %v (%v)", result, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	monkey := New()
+
+	var logged []string
+
+	monkey.Register("log", func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			logged = append(logged, arg.Inspect())
+		}
+		return nil
+	})
+
+	monkey.Register("double", func(args ...object.Object) object.Object {
+		integer, ok := args[0].(*object.Integer)
+
+		if !ok {
+			return &object.Error{Message: "double wants an INTEGER"}
+		}
+
+		return &object.Integer{Value: 2 * integer.Value}
+	})
+
+	// a host function shadows the builtin of the same name
+	monkey.Register("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	result, err := monkey.Run(`log("a", 1); log(double(21)); len([1, 2])`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Inspect() != "-1" {
+		t.Errorf("expected the host len, got %s", result.Inspect())
+	}
+
+	if !reflect.DeepEqual(logged, []string{"a", "1", "42"}) {
+		t.Errorf("wrong log, got %v", logged)
+	}
+
+	monkey.RegisterCallback("twice", func(caller object.Caller, args ...object.Object) (object.Object, error) {
+		once, err := caller.Call(args[0], args[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return caller.Call(args[0], once)
+	})
+
+	result, err = monkey.Run(`twice(fn(x) { x * 3 }, 2)`)
+
+	if err != nil || result.Inspect() != "18" {
+		t.Errorf("expected 18, got %v (%v)", result, err)
+	}
+
+	result, err = monkey.Run(`double("x")`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Inspect() != "ERROR: double wants an INTEGER" {
+		t.Errorf("expected the error of double, got %s", result.Inspect())
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	monkey := New()
+
+	limit, err := FromGo(10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monkey.SetGlobal("limit", limit)
+
+	_, err = monkey.Run("let doubled = limit * 2; limit = limit + 1;")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]int64{"limit": 11, "doubled": 20} {
+		value, err := monkey.GetGlobal(name)
+
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if value.Inspect() != strconv.FormatInt(expected, 10) {
+			t.Errorf("%s: got %s, want %d", name, value.Inspect(), expected)
+		}
+	}
+
+	// setting a global the program defined changes what it sees
+	monkey.SetGlobal("doubled", &object.Integer{Value: 7})
+
+	result, err := monkey.Run("doubled")
+
+	if err != nil || result.Inspect() != "7" {
+		t.Errorf("expected 7, got %v (%v)", result, err)
+	}
+
+	for _, name := range []string{"missing", "len"} {
+		_, err = monkey.GetGlobal(name)
+
+		if !errors.Is(err, ErrNotGlobal) {
+			t.Errorf("%s: expected ErrNotGlobal, got %v", name, err)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	monkey := New()
+
+	_, err := monkey.Run(`
+		let total = 0;
+		let add = fn(x, y) { x + y };
+		let counter = fn() { let count = 0; fn() { count += 1; total += 1; count } }();
+		let apply = fn(f, x) { f(x) };
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add, _ := monkey.GetGlobal("add")
+
+	result, err := monkey.Call(add, &object.Integer{Value: 40}, &object.Integer{Value: 2})
+
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("expected 42, got %v (%v)", result, err)
+	}
+
+	// a closure keeps its captured variables from one call to the next, and assigns globals
+	counter, _ := monkey.GetGlobal("counter")
+
+	for expected := 1; expected <= 3; expected++ {
+		result, err := monkey.Call(counter)
+
+		if err != nil || result.Inspect() != strconv.Itoa(expected) {
+			t.Errorf("expected %d, got %v (%v)", expected, result, err)
+		}
+	}
+
+	total, _ := monkey.GetGlobal("total")
+
+	if total.Inspect() != "3" {
+		t.Errorf("expected total 3, got %s", total.Inspect())
+	}
+
+	// a Go function handed to a Monkey function
+	apply, _ := monkey.GetGlobal("apply")
+	square, _ := FromGo(func(args ...object.Object) object.Object {
+		value := args[0].(*object.Integer).Value
+		return &object.Integer{Value: value * value}
+	})
+
+	result, err = monkey.Call(apply, square, &object.Integer{Value: 9})
+
+	if err != nil || result.Inspect() != "81" {
+		t.Errorf("expected 81, got %v (%v)", result, err)
+	}
+
+	_, err = monkey.Call(add, &object.Integer{Value: 1})
+
+	var runtimeError *vm.RuntimeError
+	if !errors.As(err, &runtimeError) || !strings.Contains(err.Error(), "wrong number of arguments") {
+		t.Errorf("expected a wrong number of arguments runtime error, got %v", err)
+	}
+
+	_, err = monkey.Call(&object.Integer{Value: 1})
+
+	if err == nil {
+		t.Errorf("expected an error calling an integer")
+	}
+}
+
+func TestCallBudget(t *testing.T) {
+	monkey := NewWithOptions(Options{VM: vm.Options{MaxInstructions: 10_000}})
+
+	_, err := monkey.Run("let spin = fn() { while (true) { } };")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spin, _ := monkey.GetGlobal("spin")
+
+	_, err = monkey.Call(spin)
+
+	if !errors.Is(err, vm.ErrBudgetExceeded) {
+		t.Errorf("expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		input    any
+		inspect  string
+		expected any // what ToGo gives back
+	}{
+		{nil, "null", nil},
+		{true, "true", true},
+		{42, "42", int64(42)},
+		{uint8(7), "7", int64(7)},
+		{1.5, "1.5", 1.5},
+		{"monkey", "monkey", "monkey"},
+		{[]int{1, 2}, "[1, 2]", []any{int64(1), int64(2)}},
+		{[]any{"a", false, nil}, "[a, false, null]", []any{"a", false, nil}},
+		{map[string]int{"one": 1}, "{one: 1}", map[any]any{"one": int64(1)}},
+		{map[int][]string{1: {"x"}}, "{1: [x]}", map[any]any{int64(1): []any{"x"}}},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+
+		if err != nil {
+			t.Fatalf("FromGo(%v): %s", tt.input, err)
+		}
+
+		if obj.Inspect() != tt.inspect {
+			t.Errorf("FromGo(%v): got %s, want %s", tt.input, obj.Inspect(), tt.inspect)
+		}
+
+		value, err := ToGo(obj)
+
+		if err != nil {
+			t.Fatalf("ToGo(%s): %s", obj.Inspect(), err)
+		}
+
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("ToGo(%s): got %#v, want %#v", obj.Inspect(), value, tt.expected)
+		}
+	}
+
+	// booleans are the VM's own, ! and == rely on it
+	yes, _ := FromGo(true)
+
+	if yes != vm.True {
+		t.Errorf("FromGo(true) is not vm.True")
+	}
+
+	if _, err := FromGo(make(chan int)); err == nil {
+		t.Errorf("expected an error converting a channel")
+	}
+
+	if _, err := FromGo(map[bool][]int{true: nil}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if _, err := ToGo(&object.Error{Message: "boom"}); err == nil || err.Error() != "boom" {
+		t.Errorf("expected the error boom, got %v", err)
+	}
+
+	monkey := New()
+	cyclic, err := monkey.Run("let a = [1]; a[0] = a; a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ToGo(cyclic); !errors.Is(err, ErrCycle) {
+		t.Errorf("expected ErrCycle, got %v", err)
+	}
+
+	// the same array twice is not a cycle
+	shared, err := monkey.Run("let b = [1]; [b, b]")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ToGo(shared); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -7,13 +7,24 @@ type Lexer struct {
 	position     int  // current position in the input (points to current character) // and where we last read
 	readPosition int  // current reading position in the input (after current character)
 	ch           byte // current char under examination
+	filename     string
+	line         int // line of the current char, starting at 1
+	column       int // column of the current char, starting at 1
+	keepComments bool
 }
 
 const BLANK_WHITESPACE = ' '
 
 func New(input string) *Lexer {
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename stamps the filename on every token position, so errors can say where they come from
+func NewWithFilename(filename string, input string) *Lexer {
 	lexer := &Lexer{
-		input: input,
+		input:    input,
+		filename: filename,
+		line:     1,
 	}
 
 	lexer.readChar()
@@ -21,7 +32,20 @@ func New(input string) *Lexer {
 	return lexer
 }
 
+// KeepComments makes NextToken return comments as token.COMMENT trivia instead of skipping them,
+// for tools that need to preserve them
+func (lexer *Lexer) KeepComments(keep bool) {
+	lexer.keepComments = keep
+}
+
 func (lexer *Lexer) readChar() {
+	if lexer.ch == '\n' {
+		lexer.line++
+		lexer.column = 1
+	} else {
+		lexer.column++
+	}
+
 	//  is to check whether we have reached the end of input.
 	if lexer.readPosition >= len(lexer.input) {
 		// 0 is the ASCII code for 'NUL' character
@@ -38,6 +62,15 @@ func (lexer *Lexer) readChar() {
 	lexer.readPosition++
 }
 
+func (lexer *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: lexer.filename,
+		Offset:   lexer.position,
+		Line:     lexer.line,
+		Column:   lexer.column,
+	}
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{
 		Type:    tokenType,
@@ -45,10 +78,31 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	}
 }
 
+// readTwoCharToken consumes the current char, leaving the second one for NextToken to step over
+func (lexer *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := lexer.ch
+	lexer.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(lexer.ch)}
+}
+
 func (lexer *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		lexer.skipWhitespace()
+
+		start := lexer.currentPosition()
+		tok := lexer.nextToken()
+		tok.Span = token.Span{Start: start, End: lexer.currentPosition()}
 
-	lexer.skipWhitespace()
+		if tok.Type == token.COMMENT && !lexer.keepComments {
+			continue
+		}
+
+		return tok
+	}
+}
+
+func (lexer *Lexer) nextToken() token.Token {
+	var tok token.Token
 
 	switch lexer.ch {
 	case '=':
@@ -60,9 +114,17 @@ func (lexer *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, lexer.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, lexer.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, lexer.ch)
+		}
 	case '!':
 		if lexer.peekChar() == '=' {
 			ch := lexer.ch
@@ -73,13 +135,55 @@ func (lexer *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, lexer.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, lexer.ch)
+		if lexer.peekChar() == '/' {
+			tok.Type = token.COMMENT
+			tok.Literal = lexer.readLineComment()
+			return tok
+		} else if lexer.peekChar() == '*' {
+			comment, terminated := lexer.readBlockComment()
+			tok.Type = token.COMMENT
+			tok.Literal = comment
+			if !terminated {
+				tok.Type = token.ILLEGAL
+			}
+			return tok
+		} else if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, lexer.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, lexer.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, lexer.ch)
 	case '<':
-		tok = newToken(token.LT, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, lexer.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, lexer.ch)
+		if lexer.peekChar() == '=' {
+			tok = lexer.readTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, lexer.ch)
+		}
+	case '&':
+		if lexer.peekChar() == '&' {
+			tok = lexer.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, lexer.ch)
+		}
+	case '|':
+		if lexer.peekChar() == '|' {
+			tok = lexer.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.ILLEGAL, lexer.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, lexer.ch)
 	case ':':
@@ -110,8 +214,7 @@ func (lexer *Lexer) NextToken() token.Token {
 			tok.Type = token.LookUpIdent(tok.Literal)
 			return tok
 		} else if isDigit(lexer.ch) {
-			tok.Type = token.INT
-			tok.Literal = lexer.readNumber()
+			tok.Literal, tok.Type = lexer.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, lexer.ch)
@@ -145,12 +248,48 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (lexer *Lexer) readNumber() string {
+// readNumber reads an integer, or a float when a fraction or an exponent follows the digits
+func (lexer *Lexer) readNumber() (string, token.TokenType) {
 	initialPosition := lexer.position
+	tokenType := token.TokenType(token.INT)
+
+	lexer.readDigits()
+
+	if lexer.ch == '.' && isDigit(lexer.peekChar()) {
+		tokenType = token.FLOAT
+		lexer.readChar()
+		lexer.readDigits()
+	}
+
+	if lexer.ch == 'e' || lexer.ch == 'E' {
+		next := lexer.peekChar()
+
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(lexer.peekCharAt(1)) {
+			tokenType = token.FLOAT
+			lexer.readChar()
+			if lexer.ch == '+' || lexer.ch == '-' {
+				lexer.readChar()
+			}
+			lexer.readDigits()
+		}
+	}
+
+	return lexer.input[initialPosition:lexer.position], tokenType
+}
+
+func (lexer *Lexer) readDigits() {
 	for isDigit(lexer.ch) {
 		lexer.readChar()
 	}
-	return lexer.input[initialPosition:lexer.position]
+}
+
+// peekCharAt looks offset characters past the next one, peekCharAt(0) is peekChar
+func (lexer *Lexer) peekCharAt(offset int) byte {
+	if lexer.readPosition+offset >= len(lexer.input) {
+		return 0
+	}
+
+	return lexer.input[lexer.readPosition+offset]
 }
 
 func (lexer *Lexer) peekChar() byte {
@@ -173,3 +312,39 @@ func (self *Lexer) readString() string {
 
 	return self.input[position:self.position]
 }
+
+// readLineComment reads up to the end of the line, the newline itself is left to skipWhitespace
+func (lexer *Lexer) readLineComment() string {
+	initialPosition := lexer.position
+
+	for lexer.ch != '\n' && lexer.ch != 0 {
+		lexer.readChar()
+	}
+
+	return lexer.input[initialPosition:lexer.position]
+}
+
+// readBlockComment reads a /* */ comment, block comments nest.
+// It reports false when the input ends before the comment is closed.
+func (lexer *Lexer) readBlockComment() (string, bool) {
+	initialPosition := lexer.position
+	depth := 0
+
+	for lexer.ch != 0 {
+		if lexer.ch == '/' && lexer.peekChar() == '*' {
+			depth++
+			lexer.readChar()
+		} else if lexer.ch == '*' && lexer.peekChar() == '/' {
+			depth--
+			lexer.readChar()
+		}
+
+		lexer.readChar()
+
+		if depth == 0 {
+			return lexer.input[initialPosition:lexer.position], true
+		}
+	}
+
+	return lexer.input[initialPosition:lexer.position], false
+}
@@ -109,7 +109,7 @@ let result = add(five, ten);
 }
 
 // Note that although the input looks like an actual piece of Monkey source code, some lines don’t
-// really make sense, with gibberish like !-/*5. That’s okay. The lexer’s job is not to tell us
+// really make sense, with gibberish like !-/ *5. That’s okay. The lexer’s job is not to tell us
 // whether code makes sense, works or contains errors. That comes in a later stage
 // The lexer
 // should only turn this input into tokens
@@ -123,7 +123,7 @@ x + y ;
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 `
 
@@ -207,7 +207,7 @@ x + y ;
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 if ( 5 < 10 ){
 return true;
@@ -313,7 +313,7 @@ x + y ;
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 if ( 5 < 10 ){
 return true;
@@ -437,3 +437,221 @@ return false;
 	}
 
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+  "ab" == five;`
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, token.Position{Filename: "main.monkey", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "main.monkey", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Filename: "main.monkey", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "main.monkey", Offset: 8, Line: 1, Column: 9}},
+		{token.ASSIGN, token.Position{Filename: "main.monkey", Offset: 9, Line: 1, Column: 10}, token.Position{Filename: "main.monkey", Offset: 10, Line: 1, Column: 11}},
+		{token.INT, token.Position{Filename: "main.monkey", Offset: 11, Line: 1, Column: 12}, token.Position{Filename: "main.monkey", Offset: 12, Line: 1, Column: 13}},
+		{token.SEMICOLON, token.Position{Filename: "main.monkey", Offset: 12, Line: 1, Column: 13}, token.Position{Filename: "main.monkey", Offset: 13, Line: 1, Column: 14}},
+		{token.STRING, token.Position{Filename: "main.monkey", Offset: 16, Line: 2, Column: 3}, token.Position{Filename: "main.monkey", Offset: 20, Line: 2, Column: 7}},
+		{token.EQ, token.Position{Filename: "main.monkey", Offset: 21, Line: 2, Column: 8}, token.Position{Filename: "main.monkey", Offset: 23, Line: 2, Column: 10}},
+		{token.IDENT, token.Position{Filename: "main.monkey", Offset: 24, Line: 2, Column: 11}, token.Position{Filename: "main.monkey", Offset: 28, Line: 2, Column: 15}},
+	}
+
+	lexer := NewWithFilename("main.monkey", input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - Type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Span.Start != tt.expectedStart {
+			t.Fatalf("tests[%d] - start wrong. expected=%+v, got=%+v", i, tt.expectedStart, tok.Span.Start)
+		}
+
+		if tok.Span.End != tt.expectedEnd {
+			t.Fatalf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.Span.End)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let five = 5; // trailing comment
+/* block
+   /* nested */ still a comment */
+five / 1;
+/* never closed`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading comment"},
+		{token.LET, "let"},
+		{token.IDENT, "five"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing comment"},
+		{token.COMMENT, "/* block\n   /* nested */ still a comment */"},
+		{token.IDENT, "five"},
+		{token.SLASH, "/"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "/* never closed"},
+		{token.EOF, ""},
+	}
+
+	keeping := New(input)
+	keeping.KeepComments(true)
+
+	skipping := New(input)
+
+	for i, tt := range tests {
+		tok := keeping.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - Type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+
+		tok = skipping.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - comment not skipped. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestFloatLiterals(t *testing.T) {
+	input := `1.5 0.25 10 1e-9 2E+3 7e 3.x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25"},
+		{token.INT, "10"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.INT, "3"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - Type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := `a <= b >= c && d || e % f < g & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.LT, "<"},
+		{token.IDENT, "g"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - Type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; x / 6;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "6"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - Type wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
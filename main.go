@@ -1,13 +1,30 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/Neal-C/compiler-in-go/repl"
 	"os"
 	"os/user"
 )
 
+// flags shared by the REPL and the subcommands, a subcommand also accepts them after its name
+var optimize = flag.Bool("O", false, "run the peephole optimizer over the compiled bytecode")
+var engine = flag.String("engine", engineVM, "run programs in the 'vm' or with the tree-walking 'eval'uator")
+
 func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Arg(0), flag.Args()[1:]))
+	}
+
+	if *engine != engineVM && *engine != engineEval {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, want %q or %q\n", *engine, engineVM, engineEval)
+		os.Exit(exitUsage)
+	}
+
 	currentUser, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +32,20 @@ func main() {
 
 	fmt.Printf("Hello %s ! This is the monkey programming language ! \n", currentUser.Username)
 	fmt.Printf("Start typing commands \n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.StartWithOptions(os.Stdin, os.Stdout, repl.Options{Optimize: *optimize, Evaluate: *engine == engineEval})
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: %[1]s [-O] [--engine=vm|eval]                   start the REPL
+       %[1]s [-O] [--engine=vm|eval] run <file>        run a .monkey file
+       %[1]s [-O] build <file> [-o out.mbc]            compile a .monkey file to bytecode
+       %[1]s exec <file.mbc>                           run compiled bytecode
+       %[1]s [-O] disasm <file>                        disassemble a .monkey or .mbc file
+       %[1]s tokens <file>                             print the tokens of a .monkey file
+       %[1]s ast <file>                                print the syntax tree of a .monkey file
+
+exit codes: 0 success, 1 runtime error, 2 usage, 3 parse error, 4 compile error, 5 unreadable, unwritable or invalid file
+
+`, os.Args[0])
+	flag.PrintDefaults()
 }
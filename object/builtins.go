@@ -2,6 +2,9 @@ package object
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var Builtins = []struct {
@@ -130,6 +133,323 @@ var Builtins = []struct {
 			},
 		},
 	},
+	{
+		Name: "int",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					return &Integer{Value: int64(arg.Value)}
+				case *String:
+					value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 0, 64)
+					if err != nil {
+						return newError("could not convert %q to INTEGER", arg.Value)
+					}
+					return &Integer{Value: value}
+				default:
+					return newError("argument to int not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "float",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("could not convert %q to FLOAT", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return newError("argument to float not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		Name: "map",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				array, fn, err := arrayAndFunction("map", args)
+
+				if err != nil {
+					return err, nil
+				}
+
+				elements := make([]Object, len(array.Elements))
+
+				for index, element := range array.Elements {
+					result, err := caller.Call(fn, element)
+
+					if err != nil {
+						return nil, err
+					}
+
+					elements[index] = result
+				}
+
+				return &Array{Elements: elements}, nil
+			},
+		},
+	},
+	{
+		Name: "filter",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				array, fn, err := arrayAndFunction("filter", args)
+
+				if err != nil {
+					return err, nil
+				}
+
+				elements := []Object{}
+
+				for _, element := range array.Elements {
+					result, err := caller.Call(fn, element)
+
+					if err != nil {
+						return nil, err
+					}
+
+					if IsTruthy(result) {
+						elements = append(elements, element)
+					}
+				}
+
+				return &Array{Elements: elements}, nil
+			},
+		},
+	},
+	{
+		Name: "reduce",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args)), nil
+				}
+
+				array, fn, err := arrayAndFunction("reduce", []Object{args[0], args[2]})
+
+				if err != nil {
+					return err, nil
+				}
+
+				accumulator := args[1]
+
+				for _, element := range array.Elements {
+					result, err := caller.Call(fn, accumulator, element)
+
+					if err != nil {
+						return nil, err
+					}
+
+					accumulator = result
+				}
+
+				return accumulator, nil
+			},
+		},
+	},
+	{
+		Name: "each",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				array, fn, err := arrayAndFunction("each", args)
+
+				if err != nil {
+					return err, nil
+				}
+
+				for _, element := range array.Elements {
+					_, err := caller.Call(fn, element)
+
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				return NULL, nil
+			},
+		},
+	},
+	{
+		Name: "find",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				array, fn, err := arrayAndFunction("find", args)
+
+				if err != nil {
+					return err, nil
+				}
+
+				for _, element := range array.Elements {
+					result, err := caller.Call(fn, element)
+
+					if err != nil {
+						return nil, err
+					}
+
+					if IsTruthy(result) {
+						return element, nil
+					}
+				}
+
+				return NULL, nil
+			},
+		},
+	},
+	{
+		Name: "any",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				return quantify("any", true, caller, args)
+			},
+		},
+	},
+	{
+		Name: "all",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				return quantify("all", false, caller, args)
+			},
+		},
+	},
+	{
+		Name: "sort_by",
+		Builtin: &Builtin{
+			CallbackFn: func(caller Caller, args ...Object) (Object, error) {
+				array, fn, err := arrayAndFunction("sort_by", args)
+
+				if err != nil {
+					return err, nil
+				}
+
+				keys := make([]Object, len(array.Elements))
+
+				for index, element := range array.Elements {
+					key, err := caller.Call(fn, element)
+
+					if err != nil {
+						return nil, err
+					}
+
+					keys[index] = key
+				}
+
+				for _, key := range keys {
+					if !comparableKeys(keys[0], key) {
+						return newError("sort_by keys must all be numbers or all be strings, got %s and %s",
+							keys[0].Type(), key.Type()), nil
+					}
+				}
+
+				order := make([]int, len(keys))
+
+				for index := range order {
+					order[index] = index
+				}
+
+				// stable, elements with equal keys keep their order
+				sort.SliceStable(order, func(i int, j int) bool {
+					return lessSortKey(keys[order[i]], keys[order[j]])
+				})
+
+				elements := make([]Object, len(order))
+
+				for index, position := range order {
+					elements[index] = array.Elements[position]
+				}
+
+				return &Array{Elements: elements}, nil
+			},
+		},
+	},
+}
+
+// arrayAndFunction checks the arguments of a builtin taking an array and a function to apply to its elements
+func arrayAndFunction(name string, args []Object) (*Array, Object, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	array, ok := args[0].(*Array)
+
+	if !ok {
+		return nil, nil, newError("first argument to %s must be an ARRAY, got %s", name, args[0].Type())
+	}
+
+	switch args[1].(type) {
+	case *Closure, *Function, *Builtin:
+		return array, args[1], nil
+	default:
+		return nil, nil, newError("last argument to %s must be a function, got %s", name, args[1].Type())
+	}
+}
+
+// quantify is any when stopAt is true, all when it is false: it stops at the first element the function says stopAt for
+func quantify(name string, stopAt bool, caller Caller, args []Object) (Object, error) {
+	array, fn, err := arrayAndFunction(name, args)
+
+	if err != nil {
+		return err, nil
+	}
+
+	for _, element := range array.Elements {
+		result, err := caller.Call(fn, element)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if IsTruthy(result) == stopAt {
+			return NativeBoolToBoolean(stopAt), nil
+		}
+	}
+
+	return NativeBoolToBoolean(!stopAt), nil
+}
+
+func comparableKeys(left Object, right Object) bool {
+	switch left.(type) {
+	case *Integer, *Float:
+		return right.Type() == INTEGER_OBJ || right.Type() == FLOAT_OBJ
+	case *String:
+		return right.Type() == STRING_OBJ
+	default:
+		return false
+	}
+}
+
+// lessSortKey orders numbers by value, integers mixed with floats, and strings byte-wise
+func lessSortKey(left Object, right Object) bool {
+	if left, ok := left.(*String); ok {
+		return left.Value < right.(*String).Value
+	}
+
+	if left, ok := left.(*Integer); ok {
+		if right, ok := right.(*Integer); ok {
+			return left.Value < right.Value
+		}
+	}
+
+	return ToFloat(left) < ToFloat(right)
 }
 
 func newError(format string, a ...any) *Error {
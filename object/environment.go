@@ -26,6 +26,20 @@ func (self *Environment) Set(name string, value Object) Object {
 	return value
 }
 
+// Assign rebinds an existing variable in the environment that defined it, it reports false when there is none
+func (self *Environment) Assign(name string, value Object) bool {
+	if _, ok := self.store[name]; ok {
+		self.store[name] = value
+		return true
+	}
+
+	if self.outer != nil {
+		return self.outer.Assign(name, value)
+	}
+
+	return false
+}
+
 func NewEnclosedEnvironment(outerEnv *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outerEnv
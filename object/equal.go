@@ -0,0 +1,103 @@
+package object
+
+// Equal is what == tests in the VM and the evaluator, != is its negation:
+//   - numbers by value, an integer equals the float of the same value
+//   - booleans, null and strings by value
+//   - arrays element by element, hashes by their keys and the values under them, recursively
+//   - anything else, functions, closures and builtins, by identity
+//
+// An array or a hash that contains itself compares without recursing forever.
+func Equal(left Object, right Object) bool {
+	return equal(left, right, make(map[[2]Object]bool))
+}
+
+// comparing holds the pairs of arrays and hashes already met in this comparison, meeting one again
+// is a cycle or a value shared twice: it is assumed equal, any difference fails the comparison where it is found.
+// The pairs are kept until the end so that a value shared many times is compared once.
+func equal(left Object, right Object, comparing map[[2]Object]bool) bool {
+	switch left := left.(type) {
+	case *Integer:
+		switch right := right.(type) {
+		case *Integer:
+			return left.Value == right.Value
+		case *Float:
+			return float64(left.Value) == right.Value
+		}
+
+		return false
+	case *Float:
+		switch right := right.(type) {
+		case *Integer:
+			return left.Value == float64(right.Value)
+		case *Float:
+			return left.Value == right.Value
+		}
+
+		return false
+	case *Boolean:
+		right, ok := right.(*Boolean)
+		return ok && left.Value == right.Value
+	case *Null:
+		_, ok := right.(*Null)
+		return ok
+	case *String:
+		right, ok := right.(*String)
+		return ok && left.Value == right.Value
+	case *Array:
+		right, ok := right.(*Array)
+
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+
+		if left == right {
+			return true
+		}
+
+		pair := [2]Object{left, right}
+
+		if comparing[pair] {
+			return true
+		}
+
+		comparing[pair] = true
+
+		for index, element := range left.Elements {
+			if !equal(element, right.Elements[index], comparing) {
+				return false
+			}
+		}
+
+		return true
+	case *Hash:
+		right, ok := right.(*Hash)
+
+		if !ok || len(left.Pairs) != len(right.Pairs) {
+			return false
+		}
+
+		if left == right {
+			return true
+		}
+
+		pair := [2]Object{left, right}
+
+		if comparing[pair] {
+			return true
+		}
+
+		comparing[pair] = true
+
+		for hashKey, leftPair := range left.Pairs {
+			rightPair, ok := right.Pairs[hashKey]
+
+			if !ok || !equal(leftPair.Value, rightPair.Value, comparing) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return left == right
+}
@@ -0,0 +1,72 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	selfArray := &Array{}
+	selfArray.Elements = []Object{selfArray}
+
+	otherSelfArray := &Array{}
+	otherSelfArray.Elements = []Object{otherSelfArray}
+
+	// a cycle through two arrays, equal to the cycle through one when unrolled
+	first := &Array{}
+	second := &Array{Elements: []Object{first}}
+	first.Elements = []Object{second}
+
+	selfHash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "self"}
+	selfHash.Pairs[key.HashKey()] = HashPair{Key: key, Value: selfHash}
+
+	closure := &Closure{Fn: &CompiledFunction{}}
+
+	// every level holds the one below twice, 2^64 paths to walk without remembering the pairs met
+	var deep, otherDeep, differentDeep Object = NULL, NULL, &Integer{Value: 1}
+
+	for level := 0; level < 64; level++ {
+		deep = &Array{Elements: []Object{deep, deep}}
+		otherDeep = &Array{Elements: []Object{otherDeep, otherDeep}}
+		differentDeep = &Array{Elements: []Object{differentDeep, differentDeep}}
+	}
+
+	tableTests := []struct {
+		name     string
+		left     Object
+		right    Object
+		expected bool
+	}{
+		{"integers", &Integer{Value: 1}, &Integer{Value: 1}, true},
+		{"integer and float", &Integer{Value: 2}, &Float{Value: 2}, true},
+		{"float and integer", &Float{Value: 2.5}, &Integer{Value: 2}, false},
+		{"strings", &String{Value: "a"}, &String{Value: "a"}, true},
+		{"string and integer", &String{Value: "1"}, &Integer{Value: 1}, false},
+		{"booleans", &Boolean{Value: true}, TRUE, true},
+		{"nulls", &Null{}, NULL, true},
+		{"null and false", NULL, FALSE, false},
+		{"arrays", &Array{Elements: []Object{&Integer{Value: 1}}}, &Array{Elements: []Object{&Integer{Value: 1}}}, true},
+		{"arrays of different lengths", &Array{}, &Array{Elements: []Object{NULL}}, false},
+		{"self-referencing arrays", selfArray, otherSelfArray, true},
+		{"cycles of different lengths", selfArray, first, true},
+		{"self-referencing array and empty array", selfArray, &Array{}, false},
+		{"self-referencing hash", selfHash, selfHash, true},
+		{"same deep shared array", deep, deep, true},
+		{"deep shared arrays", deep, otherDeep, true},
+		{"different deep shared arrays", deep, differentDeep, false},
+		{"same closure", closure, closure, true},
+		{"closures", closure, &Closure{Fn: closure.Fn}, false},
+		{"nils", nil, nil, true},
+		{"array and nil", &Array{}, nil, false},
+	}
+
+	for _, tt := range tableTests {
+		if got := Equal(tt.left, tt.right); got != tt.expected {
+			t.Errorf("%s: Equal = %t, want %t", tt.name, got, tt.expected)
+		}
+
+		if got := Equal(tt.right, tt.left); got != tt.expected {
+			t.Errorf("%s, swapped: Equal = %t, want %t", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -7,14 +7,20 @@ import (
 	"github.com/Neal-C/compiler-in-go/code"
 	"hash/fnv"
 	"log"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -23,6 +29,7 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
 )
 
 type ObjectType string
@@ -38,6 +45,39 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+type Float struct {
+	Value float64
+}
+
+// Inspect always shows a fraction or an exponent, so that 2.0 does not read as the integer 2
+func (f *Float) Inspect() string {
+	formatted := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	if strings.ContainsAny(formatted, ".eIN") {
+		return formatted
+	}
+
+	return formatted + ".0"
+}
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// IsNumber reports an INTEGER or a FLOAT, integers mixed with floats are computed as floats
+func IsNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// ToFloat is the value of an INTEGER or a FLOAT as a float64, 0 for anything else
+func ToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -50,6 +90,34 @@ type Null struct{}
 func (self *Null) Type() ObjectType { return NULL_OBJ }
 func (self *Null) Inspect() string  { return "null" }
 
+// TRUE, FALSE and NULL are the only booleans and null the VM, the evaluator and the builtins create,
+// ! and == compare them by identity
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func NativeBoolToBoolean(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+// IsTruthy is what conditions test: false and null are falsy, every other value is truthy
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
 type ReturnValue struct {
 	Value Object
 }
@@ -57,6 +125,17 @@ type ReturnValue struct {
 func (self *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (self *ReturnValue) Inspect() string  { return self.Value.Inspect() }
 
+// Break and Continue carry loop control out of nested blocks in the evaluator, the same way ReturnValue does
+type Break struct{}
+
+func (self *Break) Type() ObjectType { return BREAK_OBJ }
+func (self *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (self *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (self *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
 }
@@ -98,8 +177,28 @@ func (self *String) Inspect() string  { return self.Value }
 
 type BuiltinFunction func(args ...Object) Object
 
+// Caller applies a closure, a function or a builtin to arguments, the VM and the evaluator hand one to builtins
+// that take functions. A failure of the call comes back as the error, the builtin returns it as is.
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+}
+
+// CallbackFunction is a builtin that applies the functions it is given through caller, like map or filter
+type CallbackFunction func(caller Caller, args ...Object) (Object, error)
+
+// Builtin is a function written in Go, either Fn or CallbackFn is set
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn         BuiltinFunction
+	CallbackFn CallbackFunction
+}
+
+// Call runs the builtin, the VM and the evaluator turn a nil result into null
+func (self *Builtin) Call(caller Caller, args ...Object) (Object, error) {
+	if self.CallbackFn != nil {
+		return self.CallbackFn(caller, args...)
+	}
+
+	return self.Fn(args...), nil
 }
 
 func (self *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -111,12 +210,16 @@ type Array struct {
 
 func (self *Array) Type() ObjectType { return ARRAY_OBJ }
 func (self *Array) Inspect() string {
+	return inspect(self, make(map[Object]bool))
+}
+
+func (self *Array) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 
 	var elements []string
 
 	for _, element := range self.Elements {
-		elements = append(elements, element.Inspect())
+		elements = append(elements, inspect(element, visiting))
 	}
 
 	out.WriteString("[")
@@ -126,6 +229,33 @@ func (self *Array) Inspect() string {
 	return out.String()
 }
 
+// inspect prints arrays and hashes that contain themselves, index assignment can make them:
+// one already being printed further up shows as [...] or {...}
+func inspect(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		return obj.inspect(visiting)
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		return obj.inspect(visiting)
+	default:
+		return obj.Inspect()
+	}
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -151,6 +281,10 @@ func (self *Integer) HashKey() HashKey {
 	return HashKey{Type: self.Type(), Value: uint64(self.Value)}
 }
 
+func (self *Float) HashKey() HashKey {
+	return HashKey{Type: self.Type(), Value: math.Float64bits(self.Value)}
+}
+
 func (self *String) HashKey() HashKey {
 	h := fnv.New64()
 	_, err := h.Write([]byte(self.Value))
@@ -173,12 +307,16 @@ type Hash struct {
 func (self *Hash) Type() ObjectType { return HASH_OBJ }
 
 func (self *Hash) Inspect() string {
+	return inspect(self, make(map[Object]bool))
+}
+
+func (self *Hash) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 
 	var pairs []string
 
 	for _, pair := range self.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, visiting)))
 	}
 
 	out.WriteString("{")
@@ -188,10 +326,73 @@ func (self *Hash) Inspect() string {
 	return out.String()
 }
 
+// SortedPairs returns the pairs ordered by key type, then by key value,
+// so that iterating over a hash does not depend on Go's map order
+func (self *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(self.Pairs))
+
+	for _, pair := range self.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i int, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+
+	return pairs
+}
+
+func lessKey(left Object, right Object) bool {
+	if left.Type() != right.Type() {
+		return left.Type() < right.Type()
+	}
+
+	switch left := left.(type) {
+	case *Integer:
+		return left.Value < right.(*Integer).Value
+	case *Float:
+		return left.Value < right.(*Float).Value
+	case *String:
+		return left.Value < right.(*String).Value
+	case *Boolean:
+		return !left.Value && right.(*Boolean).Value
+	default:
+		return false
+	}
+}
+
+// IterableItems lists what a for loop walks over: the elements of an array,
+// the keys of a hash in SortedPairs order, or the characters of a string
+func IterableItems(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements, true
+	case *Hash:
+		pairs := obj.SortedPairs()
+		keys := make([]Object, len(pairs))
+		for index, pair := range pairs {
+			keys[index] = pair.Key
+		}
+		return keys, true
+	case *String:
+		characters := []Object{}
+		for _, character := range obj.Value {
+			characters = append(characters, &String{Value: string(character)})
+		}
+		return characters, true
+	default:
+		return nil, false
+	}
+}
+
 type CompiledFunction struct {
 	Instructions       code.Instructions
 	NumberOfLocals     int
 	NumberOfParameters int
+	SourceMap          code.SourceMap
+	Name               string
+	LocalNames         []string // debug info, the variable of each local slot
+	FreeNames          []string // debug info, the variable of each free variable
 }
 
 func (self *CompiledFunction) Type() ObjectType {
@@ -204,7 +405,7 @@ func (self *CompiledFunction) Inspect() string {
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Cell // captured variables, shared with the scope that defined them
 }
 
 func (self *Closure) Type() ObjectType {
@@ -214,3 +415,17 @@ func (self *Closure) Type() ObjectType {
 func (self *Closure) Inspect() string {
 	return fmt.Sprintf("CLOSURE[%p]", self)
 }
+
+// Cell boxes a variable captured by a closure, so that assignments on either side are seen by both.
+// The VM stores it in the local slot of the captured variable and in Closure.Free, it is never a value on its own.
+type Cell struct {
+	Value Object
+}
+
+func (self *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
+func (self *Cell) Inspect() string {
+	return fmt.Sprintf("CELL[%s]", self.Value.Inspect())
+}
@@ -23,3 +23,53 @@ func TestStringHashKey(t *testing.T) {
 	}
 
 }
+
+func TestFloatInspect(t *testing.T) {
+	tableTests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-3, "-3.0"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tableTests {
+		float := &Float{Value: tt.value}
+
+		if float.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g. want = %q, got = %q", tt.value, tt.expected, float.Inspect())
+		}
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "self"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: hash}
+
+	inner := &Array{}
+	outer := &Array{Elements: []Object{inner, inner}}
+
+	tableTests := []struct {
+		obj      Object
+		expected string
+	}{
+		{array, "[1, [...]]"},
+		{hash, "{self: {...}}"},
+		{&Array{Elements: []Object{hash}}, "[{self: {...}}]"},
+		// the same array twice is not a cycle
+		{outer, "[[], []]"},
+	}
+
+	for _, tt := range tableTests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want = %q, got = %q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package optimizer is a peephole optimizer over compiled bytecode.
+// It is optional: the bytecode it produces computes the same results as the bytecode it is given.
+package optimizer
+
+import (
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/object"
+)
+
+// Optimize returns an optimized copy of bytecode, the main program and every compiled function in the constant pool.
+// bytecode itself is left untouched, the REPL keeps compiling against its constants.
+func Optimize(bytecode *compiler.ByteCode) *compiler.ByteCode {
+	constants := make([]object.Object, len(bytecode.Constants))
+
+	for index, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+
+		if !ok {
+			constants[index] = constant
+			continue
+		}
+
+		optimized := *fn
+		optimized.Instructions, optimized.SourceMap = OptimizeInstructions(fn.Instructions, fn.SourceMap)
+		constants[index] = &optimized
+	}
+
+	instructions, sourceMap := OptimizeInstructions(bytecode.Instructions, bytecode.SourceMap)
+
+	return &compiler.ByteCode{
+		Instructions:    instructions,
+		Constants:       constants,
+		SourceMap:       sourceMap,
+		NumberOfGlobals: bytecode.NumberOfGlobals,
+		GlobalNames:     bytecode.GlobalNames,
+	}
+}
+
+// OptimizeInstructions rewrites the instructions of one function until none of these applies:
+//
+//	OpJump to the next instruction          removed
+//	OpJump or OpJumpNotTruthy to an OpJump  retargeted to the end of the chain
+//	OpTrue, OpJumpNotTruthy                 removed, the jump is never taken
+//	OpFalse, OpJumpNotTruthy                OpJump, the jump is always taken
+//	OpNull, OpPop                           removed, unless something jumps to the OpNull
+//	code after OpReturnValue, OpReturn or OpJump, up to the next jump target, removed as unreachable
+//
+// Jump targets are rewritten to the new offsets, and so is the source map.
+func OptimizeInstructions(instructions code.Instructions, sourceMap code.SourceMap) (code.Instructions, code.SourceMap) {
+	program, ok := decode(instructions)
+
+	if !ok {
+		return instructions, sourceMap
+	}
+
+	for program.threadJumps() || program.simplify() || program.removeUnreachable() {
+	}
+
+	return program.encode(sourceMap)
+}
+
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	offset   int // offset in the original instructions, to find its source position
+	target   int // index of the instruction a jump goes to, len(instructions) for the end
+	removed  bool
+}
+
+func (self *instruction) isJump() bool {
+	return self.op == code.OpJump || self.op == code.OpJumpNotTruthy
+}
+
+type program []*instruction
+
+// decode reports false for instructions it does not understand, they are left as they are
+func decode(instructions code.Instructions) (program, bool) {
+	var decoded program
+	indexByOffset := make(map[int]int)
+
+	for offset := 0; offset < len(instructions); {
+		definition, err := code.LookUp(instructions[offset])
+
+		if err != nil {
+			return nil, false
+		}
+
+		operands, read := code.ReadOperands(definition, instructions[offset+1:])
+
+		indexByOffset[offset] = len(decoded)
+		decoded = append(decoded, &instruction{op: code.Opcode(instructions[offset]), operands: operands, offset: offset})
+
+		offset += 1 + read
+	}
+
+	indexByOffset[len(instructions)] = len(decoded)
+
+	for _, ins := range decoded {
+		if !ins.isJump() {
+			continue
+		}
+
+		target, ok := indexByOffset[ins.operands[0]]
+
+		if !ok {
+			return nil, false
+		}
+
+		ins.target = target
+	}
+
+	return decoded, true
+}
+
+// next is the index of the first instruction left after index, len(self) at the end
+func (self program) next(index int) int {
+	for index++; index < len(self) && self[index].removed; index++ {
+	}
+
+	return index
+}
+
+// resolve follows removed instructions to the one that now stands in their place
+func (self program) resolve(index int) int {
+	if index < len(self) && self[index].removed {
+		return self.next(index)
+	}
+
+	return index
+}
+
+// jumpTargets is computed once per pass, removing instructions within the pass never adds a target
+// that a rewrite would have to respect
+func (self program) jumpTargets() map[int]bool {
+	targets := make(map[int]bool)
+
+	for _, ins := range self {
+		if !ins.removed && ins.isJump() {
+			targets[self.resolve(ins.target)] = true
+		}
+	}
+
+	return targets
+}
+
+func (self program) threadJumps() bool {
+	changed := false
+
+	for _, ins := range self {
+		if ins.removed || !ins.isJump() {
+			continue
+		}
+
+		target := self.resolve(ins.target)
+		visited := map[int]bool{}
+
+		// a chain of jumps that loops back on itself is left to loop
+		for target < len(self) && self[target].op == code.OpJump && !visited[target] {
+			visited[target] = true
+			target = self.resolve(self[target].target)
+		}
+
+		if target != ins.target {
+			ins.target = target
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (self program) simplify() bool {
+	changed := false
+	targets := self.jumpTargets()
+
+	for index, ins := range self {
+		if ins.removed {
+			continue
+		}
+
+		nextIndex := self.next(index)
+
+		if ins.op == code.OpJump && self.resolve(ins.target) == nextIndex {
+			ins.removed = true
+			changed = true
+			continue
+		}
+
+		if nextIndex == len(self) || targets[nextIndex] {
+			continue
+		}
+
+		next := self[nextIndex]
+
+		switch {
+		case ins.op == code.OpTrue && next.op == code.OpJumpNotTruthy:
+			ins.removed = true
+			next.removed = true
+			changed = true
+		case ins.op == code.OpFalse && next.op == code.OpJumpNotTruthy:
+			ins.removed = true
+			next.op = code.OpJump
+			changed = true
+		// a jump to the OpNull is the exit of a loop, the null is the value the loop leaves
+		case ins.op == code.OpNull && next.op == code.OpPop && !targets[index]:
+			ins.removed = true
+			next.removed = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (self program) removeUnreachable() bool {
+	changed := false
+	targets := self.jumpTargets()
+
+	for index, ins := range self {
+		if ins.removed {
+			continue
+		}
+
+		if ins.op != code.OpReturnValue && ins.op != code.OpReturn && ins.op != code.OpJump {
+			continue
+		}
+
+		for dead := self.next(index); dead < len(self) && !targets[dead]; dead = self.next(dead) {
+			self[dead].removed = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (self program) encode(sourceMap code.SourceMap) (code.Instructions, code.SourceMap) {
+	newOffsets := make([]int, len(self)+1)
+	offset := 0
+
+	for index, ins := range self {
+		newOffsets[index] = offset
+
+		if !ins.removed {
+			offset += len(code.Make(ins.op, ins.operands...))
+		}
+	}
+
+	newOffsets[len(self)] = offset
+
+	instructions := code.Instructions{}
+	var newSourceMap code.SourceMap
+
+	for _, ins := range self {
+		if ins.removed {
+			continue
+		}
+
+		if ins.isJump() {
+			ins.operands[0] = newOffsets[self.resolve(ins.target)]
+		}
+
+		if position, ok := sourceMap.Lookup(ins.offset); ok {
+			newSourceMap = newSourceMap.Add(len(instructions), position)
+		}
+
+		instructions = append(instructions, code.Make(ins.op, ins.operands...)...)
+	}
+
+	return instructions, newSourceMap
+}
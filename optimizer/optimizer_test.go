@@ -0,0 +1,289 @@
+package optimizer
+
+import (
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"github.com/Neal-C/compiler-in-go/token"
+	"github.com/Neal-C/compiler-in-go/vm"
+	"testing"
+)
+
+func concat(instructions ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func TestOptimizeInstructions(t *testing.T) {
+	tableTests := []struct {
+		name     string
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			name: "jump to the next instruction",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJump, 6),
+				// 0006
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "true then jump not truthy",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "false then jump not truthy",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpFalse),
+				// 0004
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0007
+				code.Make(code.OpConstant, 0),
+				// 0010
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "null then pop",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "jump chains",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpReturnValue),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 15),
+				// 0015
+				code.Make(code.OpJump, 18),
+				// 0018
+				code.Make(code.OpConstant, 1),
+				// 0021
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpReturnValue),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "unreachable code after a return",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "a jump not truthy that is itself a jump target stays",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0006
+				code.Make(code.OpGetGlobal, 1),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpTrue),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 19),
+				// 0016
+				code.Make(code.OpConstant, 0),
+				// 0019
+				code.Make(code.OpConstant, 1),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 19),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+			},
+		},
+		{
+			name: "a jump loop to itself stays",
+			input: []code.Instructions{
+				code.Make(code.OpJump, 0),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpJump, 0),
+			},
+		},
+	}
+
+	for _, tt := range tableTests {
+		actual, _ := OptimizeInstructions(concat(tt.input...), nil)
+		expected := concat(tt.expected...)
+
+		if actual.String() != expected.String() {
+			t.Errorf("%s: wrong instructions.\nwant =\n%s\ngot =\n%s", tt.name, expected, actual)
+		}
+	}
+}
+
+func TestOptimizeSourceMap(t *testing.T) {
+	instructions := concat(
+		// 0000
+		code.Make(code.OpTrue),
+		// 0001
+		code.Make(code.OpJumpNotTruthy, 7),
+		// 0004
+		code.Make(code.OpConstant, 0),
+		// 0007
+		code.Make(code.OpConstant, 1),
+	)
+
+	var sourceMap code.SourceMap
+	sourceMap = sourceMap.Add(0, token.Position{Line: 1, Column: 1})
+	sourceMap = sourceMap.Add(4, token.Position{Line: 2, Column: 1})
+	sourceMap = sourceMap.Add(7, token.Position{Line: 3, Column: 1})
+
+	_, optimized := OptimizeInstructions(instructions, sourceMap)
+
+	tableTests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "2:1"},
+		{3, "3:1"},
+	}
+
+	for _, tt := range tableTests {
+		position, ok := optimized.Lookup(tt.offset)
+
+		if !ok || position.String() != tt.expected {
+			t.Errorf("wrong position for offset %d. want = %s, got = %s", tt.offset, tt.expected, position)
+		}
+	}
+}
+
+// TestOptimizedPrograms runs every program with and without the optimizer, the results must be the same
+func TestOptimizedPrograms(t *testing.T) {
+	inputs := []string{
+		"if (true) { 10 }",
+		"if (false) { 10 } else { 20 }",
+		"if (1 > 2) { 10 }; 3",
+		"let f = fn(x) { if (x > 1) { return x; } else { return 0; }; 99 }; f(5) + f(1)",
+		"let f = fn(x) { if (x) { if (x > 1) { 1 } else { 2 } } else { 3 } }; [f(2), f(1), f(false)]",
+		"let i = 0; while (true) { i += 1; if (i > 3) { break; } }; i",
+		"let n = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } n += x; }; n",
+		"let i = 0; while (i < 2) { i += 1 }",
+		"for (x in [1]) { }",
+		"let fib = fn(x) { if (x < 2) { return x; } fib(x - 1) + fib(x - 2) }; fib(15)",
+		"true && false || !false",
+		"let f = fn() { }; f()",
+		"let sum = fn(n, acc) { if (n == 0) { return acc; } sum(n - 1, acc + n) }; sum(5000, 0)",
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := myCompiler.ByteCode()
+
+		expected := run(t, bytecode)
+		actual := run(t, Optimize(bytecode))
+
+		if actual.Inspect() != expected.Inspect() {
+			t.Errorf("%q: wrong result once optimized. want = %s, got = %s", input, expected.Inspect(), actual.Inspect())
+		}
+
+		if len(Optimize(bytecode).Instructions) > len(bytecode.Instructions) {
+			t.Errorf("%q: optimized instructions are longer", input)
+		}
+	}
+}
+
+func run(t *testing.T, bytecode *compiler.ByteCode) object.Object {
+	t.Helper()
+
+	machine := vm.New(bytecode)
+
+	err := machine.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return machine.LastPoppedStackElement()
+}
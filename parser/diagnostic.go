@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Neal-C/compiler-in-go/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (self Severity) String() string {
+	switch self {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(self))
+	}
+}
+
+// Diagnostic is a problem found while parsing, positioned on the offending source
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Message  string
+	Expected []token.TokenType // tokens that would have been accepted, when known
+}
+
+func (self Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", self.Span.Start, self.Severity, self.Message)
+}
+
+// Render prints the diagnostic followed by the offending source line with carets under the span
+func (self Diagnostic) Render(source string) string {
+	var out bytes.Buffer
+
+	out.WriteString(self.String() + "\n")
+
+	start := self.Span.Start
+
+	if !start.IsValid() || start.Offset > len(source) {
+		return out.String()
+	}
+
+	lineStart := strings.LastIndexByte(source[:start.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[start.Offset:], '\n')
+
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += start.Offset
+	}
+
+	width := 1
+
+	if self.Span.End.Offset > start.Offset {
+		width = min(self.Span.End.Offset, lineEnd) - start.Offset
+	}
+
+	out.WriteString(source[lineStart:lineEnd] + "\n")
+	out.WriteString(caretPadding(source[lineStart:start.Offset]))
+	out.WriteString(strings.Repeat("^", max(width, 1)) + "\n")
+
+	return out.String()
+}
+
+// caretPadding keeps tabs so the carets line up under the source whatever the tab width
+func caretPadding(prefix string) string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(prefix); i++ {
+		if prefix[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	return out.String()
+}
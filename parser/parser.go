@@ -16,6 +16,9 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	LESSGREATER
 	SUM
@@ -30,7 +33,8 @@ type Parser struct {
 	lexer          *lexer.Lexer
 	currentToken   token.Token
 	peekToken      token.Token
-	errors         []string
+	diagnostics    []Diagnostic
+	panicking      bool // set on the first error of a statement, until the parser resynchronizes
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -46,18 +50,24 @@ func (self *Parser) registerInfix(tokenKey token.TokenType, associatedFn infixPa
 func (self *Parser) nextToken() {
 	self.currentToken = self.peekToken
 	self.peekToken = self.lexer.NextToken()
+
+	// comments are trivia, even when the lexer keeps them
+	for self.peekToken.Type == token.COMMENT {
+		self.peekToken = self.lexer.NextToken()
+	}
 }
 
 func New(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
-		lexer:  lexer,
-		errors: []string{},
+		lexer:       lexer,
+		diagnostics: []Diagnostic{},
 	}
 
 	parser.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 
 	parser.registerPrefix(token.IDENT, parser.parseIdentifier)
 	parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+	parser.registerPrefix(token.FLOAT, parser.parseFloatLiteral)
 	parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
 	parser.registerPrefix(token.TRUE, parser.parseBoolean)
@@ -75,12 +85,22 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.MINUS, parser.parseInfixExpression)
 	parser.registerInfix(token.SLASH, parser.parseInfixExpression)
 	parser.registerInfix(token.ASTERISK, parser.parseInfixExpression)
+	parser.registerInfix(token.PERCENT, parser.parseInfixExpression)
 	parser.registerInfix(token.EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.NOT_EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.LT, parser.parseInfixExpression)
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
+	parser.registerInfix(token.LT_EQ, parser.parseInfixExpression)
+	parser.registerInfix(token.GT_EQ, parser.parseInfixExpression)
+	parser.registerInfix(token.AND, parser.parseInfixExpression)
+	parser.registerInfix(token.OR, parser.parseInfixExpression)
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
 	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.PLUS_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.MINUS_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.ASTERISK_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.SLASH_ASSIGN, parser.parseAssignExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	parser.nextToken()
@@ -94,7 +114,9 @@ func (self *Parser) ParseProgram() *ast.Program {
 
 	for !self.currentTokenIs(token.EOF) {
 		stmt := self.parseStatement()
-		if stmt != nil {
+		if self.panicking {
+			self.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		self.nextToken()
@@ -103,15 +125,69 @@ func (self *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// synchronize skips what is left of a broken statement, so that one syntax error
+// does not cascade into the next statements. It stops on the ';' ending the statement
+// or on a '}' closing the enclosing block, whichever comes first.
+func (self *Parser) synchronize() {
+	depth := 0
+
+	for !self.currentTokenIs(token.EOF) {
+		switch self.currentToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				self.panicking = false
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				self.panicking = false
+				return
+			}
+		}
+
+		if depth == 0 && self.peekTokenIs(token.RBRACE) {
+			break
+		}
+
+		self.nextToken()
+	}
+
+	self.panicking = false
+}
+
 func (self *Parser) parseStatement() ast.Statement {
+	// a failed statement must come back as a nil interface, not as a typed nil pointer
 	switch self.currentToken.Type {
 	case token.LET:
-		return self.parseLetStatement()
+		if stmt := self.parseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
-		return self.parseReturnStatement()
+		if stmt := self.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+	case token.WHILE:
+		if stmt := self.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+	case token.FOR:
+		if stmt := self.parseForStatement(); stmt != nil {
+			return stmt
+		}
+	case token.BREAK:
+		return self.parseBreakStatement()
+	case token.CONTINUE:
+		return self.parseContinueStatement()
 	default:
-		return self.parseExpressionStatement()
+		if stmt := self.parseExpressionStatement(); stmt != nil {
+			return stmt
+		}
 	}
+
+	return nil
 }
 
 func (self *Parser) parseIdentifier() ast.Expression {
@@ -196,14 +272,114 @@ func (self *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (self *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: self.currentToken}
+
+	if !self.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	self.nextToken()
+
+	stmt.Condition = self.parseExpression(LOWEST)
+
+	if !self.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !self.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = self.parseBlockStatement()
+
+	if self.peekTokenIs(token.SEMICOLON) {
+		self.nextToken()
+	}
+
+	return stmt
+}
+
+func (self *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: self.currentToken}
+
+	if !self.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !self.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: self.currentToken, Value: self.currentToken.Literal}
+
+	if !self.expectPeek(token.IN) {
+		return nil
+	}
+
+	self.nextToken()
+
+	stmt.Iterable = self.parseExpression(LOWEST)
+
+	if !self.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !self.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = self.parseBlockStatement()
+
+	if self.peekTokenIs(token.SEMICOLON) {
+		self.nextToken()
+	}
+
+	return stmt
+}
+
+func (self *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: self.currentToken}
+
+	if self.peekTokenIs(token.SEMICOLON) {
+		self.nextToken()
+	}
+
+	return stmt
+}
+
+func (self *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: self.currentToken}
+
+	if self.peekTokenIs(token.SEMICOLON) {
+		self.nextToken()
+	}
+
+	return stmt
+}
+
 func (self *Parser) parseIntegerLiteral() ast.Expression {
 
 	literal := &ast.IntegerLiteral{Token: self.currentToken}
 
 	value, err := strconv.ParseInt(self.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", self.currentToken.Literal)
-		self.errors = append(self.errors, msg)
+		self.addError(self.currentToken.Span, nil, "could not parse %q as integer", self.currentToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+
+	return literal
+}
+
+func (self *Parser) parseFloatLiteral() ast.Expression {
+
+	literal := &ast.FloatLiteral{Token: self.currentToken}
+
+	value, err := strconv.ParseFloat(self.currentToken.Literal, 64)
+	if err != nil {
+		self.addError(self.currentToken.Span, nil, "could not parse %q as float", self.currentToken.Literal)
 		return nil
 	}
 
@@ -241,6 +417,38 @@ func (self *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return infixExpression
 }
 
+// parseAssignExpression is right associative, a = b = c assigns c to b, then to a
+func (self *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	assignExpression := &ast.AssignExpression{
+		Token:    self.currentToken,
+		Operator: self.currentToken.Literal,
+		Target:   target,
+	}
+
+	if !isAssignable(target) {
+		span := self.currentToken.Span
+		if target != nil {
+			span = target.Span()
+		}
+		self.addError(span, nil, "invalid assignment target before %s", self.currentToken.Literal)
+		return nil
+	}
+
+	self.nextToken()
+	assignExpression.Value = self.parseExpression(ASSIGN - 1)
+
+	return assignExpression
+}
+
+func isAssignable(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	default:
+		return false
+	}
+}
+
 func (self *Parser) parseGroupedExpression() ast.Expression {
 	self.nextToken()
 
@@ -264,13 +472,22 @@ func (self *Parser) parseBlockStatement() *ast.BlockStatement {
 	for !self.currentTokenIs(token.RBRACE) && !self.currentTokenIs(token.EOF) {
 		stmt := self.parseStatement()
 
-		if stmt != nil {
+		if self.panicking {
+			self.synchronize()
+
+			// the broken statement ran into the end of the block
+			if self.currentTokenIs(token.RBRACE) {
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 
 		self.nextToken()
 	}
 
+	block.EndToken = self.currentToken
+
 	return block
 }
 
@@ -363,6 +580,7 @@ func (self *Parser) parseCallExpression(function ast.Expression) ast.Expression
 	expression := &ast.CallExpression{Token: self.currentToken, Function: function}
 
 	expression.Arguments = self.parseExpressionList(token.RPAREN)
+	expression.EndToken = self.currentToken
 
 	return expression
 }
@@ -394,8 +612,7 @@ func (self *Parser) parseCallArguments() []ast.Expression {
 }
 
 func (self *Parser) noPrefixParseFnError(tok token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function found for %s found", tok)
-	self.errors = append(self.errors, msg)
+	self.addError(self.currentToken.Span, nil, "no prefix parse function found for %s found", tok)
 }
 
 func (self *Parser) currentTokenIs(t token.TokenType) bool {
@@ -416,26 +633,64 @@ func (self *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// Errors returns the message of every error diagnostic
 func (self *Parser) Errors() []string {
-	return self.errors
+	var errors = []string{}
+
+	for _, diagnostic := range self.diagnostics {
+		if diagnostic.Severity == SeverityError {
+			errors = append(errors, diagnostic.Message)
+		}
+	}
+
+	return errors
+}
+
+func (self *Parser) Diagnostics() []Diagnostic {
+	return self.diagnostics
+}
+
+// addError reports a syntax error, unless the parser is already recovering from one in the same statement
+func (self *Parser) addError(span token.Span, expected []token.TokenType, format string, args ...any) {
+	if self.panicking {
+		return
+	}
+
+	self.panicking = true
+
+	self.diagnostics = append(self.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+		Expected: expected,
+	})
 }
 
 func (self *Parser) peekErrors(t token.TokenType) {
-	message := fmt.Sprintf("expected next token to be %s, got %s instead", t, self.peekToken.Type)
-	self.errors = append(self.errors, message)
+	self.addError(self.peekToken.Span, []token.TokenType{t}, "expected next token to be %s, got %s instead", t, self.peekToken.Type)
 }
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 func (self *Parser) peekPrecedence() int {
@@ -466,6 +721,7 @@ func (self *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: self.currentToken}
 
 	array.Elements = self.parseExpressionList(token.RBRACKET)
+	array.EndToken = self.currentToken
 
 	return array
 }
@@ -507,6 +763,8 @@ func (self *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 		return nil
 	}
 
+	expr.EndToken = self.currentToken
+
 	return expr
 }
 
@@ -540,5 +798,7 @@ func (self *Parser) parseHashLiteral() ast.Expression {
 		return nil
 	}
 
+	hash.EndToken = self.currentToken
+
 	return hash
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/Neal-C/compiler-in-go/ast"
 	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/token"
 
 	"log"
 	"testing"
@@ -370,6 +371,12 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2]), (b[1], (2 * ([1, 2][1]))",
 		},
+		{"a + b % c", "(a + (b % c))"},
+		{"a <= b == b >= a", "((a <= b) == (b >= a))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"!a || b < c", "((!a) || (b < c))"},
 	}
 
 	for _, tt := range tableTest {
@@ -968,3 +975,231 @@ func TestFunctionLiteralWithName(t *testing.T) {
 		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n", function.Name)
 	}
 }
+
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2, 3][0]);`
+
+	myLexer := lexer.New(input)
+	myParser := New(myLexer)
+	program := myParser.ParseProgram()
+	checkParserErrors(t, myParser)
+
+	tableTests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1-4:18"},
+		{program.Statements[0], "1:1-3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11-3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body.Statements[0], "2:3-2:8"},
+		{program.Statements[1], "4:1-4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8-4:17"},
+	}
+
+	for i, tt := range tableTests {
+		if tt.node.Span().String() != tt.expected {
+			t.Errorf("tests[%d] - span of %q wrong. want = %s, got = %s", i, tt.node.String(), tt.expected, tt.node.Span())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let = 5;
+let x 10;
+let y = fn(a) {
+	let = a;
+	a + 1
+};
+if (y(1) { 1 } ;
+let z = 1;`
+
+	myParser := New(lexer.New(input))
+	program := myParser.ParseProgram()
+
+	expected := []struct {
+		position string
+		message  string
+		expected []token.TokenType
+	}{
+		{"1:5", "expected next token to be IDENT, got = instead", []token.TokenType{token.IDENT}},
+		{"2:7", "expected next token to be =, got INT instead", []token.TokenType{token.ASSIGN}},
+		{"4:6", "expected next token to be IDENT, got = instead", []token.TokenType{token.IDENT}},
+		{"7:10", "expected next token to be ), got { instead", []token.TokenType{token.RPAREN}},
+	}
+
+	diagnostics := myParser.Diagnostics()
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want = %d, got = %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for i, want := range expected {
+		diagnostic := diagnostics[i]
+
+		if diagnostic.Severity != SeverityError {
+			t.Errorf("diagnostic %d has wrong severity. got = %s", i, diagnostic.Severity)
+		}
+
+		if diagnostic.Span.Start.String() != want.position {
+			t.Errorf("diagnostic %d has wrong position. want = %s, got = %s", i, want.position, diagnostic.Span.Start)
+		}
+
+		if diagnostic.Message != want.message {
+			t.Errorf("diagnostic %d has wrong message. want = %q, got = %q", i, want.message, diagnostic.Message)
+		}
+
+		if len(diagnostic.Expected) != len(want.expected) || diagnostic.Expected[0] != want.expected[0] {
+			t.Errorf("diagnostic %d has wrong expected tokens. want = %v, got = %v", i, want.expected, diagnostic.Expected)
+		}
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got = %d: %q", len(program.Statements), program.String())
+	}
+
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+
+	if len(fn.Body.Statements) != 1 || fn.Body.Statements[0].String() != "(a + 1)" {
+		t.Errorf("function body not recovered. got = %q", fn.Body.String())
+	}
+
+	testLetStatement(t, program.Statements[1], "z")
+}
+
+func TestDiagnosticRender(t *testing.T) {
+	input := "let a = 1;\nlet b 2;"
+
+	myParser := New(lexer.New(input))
+	myParser.ParseProgram()
+
+	diagnostics := myParser.Diagnostics()
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want = 1, got = %d", len(diagnostics))
+	}
+
+	expected := "2:7: error: expected next token to be =, got INT instead\nlet b 2;\n      ^\n"
+
+	if diagnostics[0].Render(input) != expected {
+		t.Errorf("wrong rendering.\nwant = %q\ngot = %q", expected, diagnostics[0].Render(input))
+	}
+}
+
+func TestParsingWithComments(t *testing.T) {
+	input := `// adds things
+let add = fn(a, /* the other one */ b) {
+	a + b // sum
+};`
+
+	myLexer := lexer.New(input)
+	myLexer.KeepComments(true)
+
+	myParser := New(myLexer)
+	program := myParser.ParseProgram()
+	checkParserErrors(t, myParser)
+
+	if program.String() != "let add = fn<add>(a, b) (a + b);" {
+		t.Errorf("program.String() wrong. got = %q", program.String())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5e-1;"
+
+	myParser := New(lexer.New(input))
+	program := myParser.ParseProgram()
+	checkParserErrors(t, myParser)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != 0.25 {
+		t.Errorf("literal.Value not %g. got=%g", 0.25, literal.Value)
+	}
+
+	if literal.TokenLiteral() != "2.5e-1" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "2.5e-1", literal.TokenLiteral())
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x; }", "while(x < 10) x"},
+		{"while (true) { break; continue; };", "whiletrue break;continue;"},
+		{"for (item in [1, 2]) { puts(item) }", "for(item in [1, 2]) puts(item)"},
+	}
+
+	for _, tt := range tableTests {
+		myParser := New(lexer.New(tt.input))
+		program := myParser.ParseProgram()
+		checkParserErrors(t, myParser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got = %d", len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want = %q, got = %q", tt.expected, program.String())
+		}
+	}
+
+	myParser := New(lexer.New("for (i in items) { }"))
+	program := myParser.ParseProgram()
+	checkParserErrors(t, myParser)
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForStatement. got = %T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "i") || !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tableTests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x += 1 * 2", "(x += (1 * 2))"},
+		{"a = b = c", "(a = (b = c))"},
+		{"x -= y || z", "(x -= (y || z))"},
+		{"let y = x *= 2;", "let y = (x *= 2);"},
+		{"f(x /= 2)", "f((x /= 2))"},
+		{"a[1] = 2", "((a[1] = 2)"},
+		{"h[\"k\"] += a[0] = 1", "((h[k] += ((a[0] = 1))"},
+	}
+
+	for _, tt := range tableTests {
+		myParser := New(lexer.New(tt.input))
+		program := myParser.ParseProgram()
+		checkParserErrors(t, myParser)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want = %q, got = %q", tt.expected, program.String())
+		}
+	}
+
+	myParser := New(lexer.New("1 = 2;"))
+	myParser.ParseProgram()
+
+	errors := myParser.Errors()
+	if len(errors) != 1 || errors[0] != "invalid assignment target before =" {
+		t.Errorf("wrong parser errors for an invalid assignment target, got = %q", errors)
+	}
+}
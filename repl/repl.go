@@ -2,10 +2,13 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/evaluator"
 	"github.com/Neal-C/compiler-in-go/lexer"
 	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/optimizer"
 	"github.com/Neal-C/compiler-in-go/parser"
 	"github.com/Neal-C/compiler-in-go/vm"
 	"io"
@@ -13,11 +16,26 @@ import (
 
 const PROMPT = ">> "
 
+// Options tune how the REPL compiles every line
+type Options struct {
+	Optimize bool // run the peephole optimizer over the bytecode
+	Evaluate bool // run every line in the tree-walking evaluator instead of the compiler and the VM
+}
+
 func Start(in io.Reader, out io.Writer) {
+	StartWithOptions(in, out, Options{})
+}
+
+func StartWithOptions(in io.Reader, out io.Writer, options Options) {
+	if options.Evaluate {
+		startEvaluator(in, out)
+		return
+	}
+
 	scanner := bufio.NewScanner(in)
 
 	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalSize)
+	globals := []object.Object{}
 	symbolTable := compiler.NewSymbolTable()
 
 	for i, v := range object.Builtins {
@@ -37,7 +55,7 @@ func Start(in io.Reader, out io.Writer) {
 		program := monkeyParser.ParseProgram()
 
 		if len(monkeyParser.Errors()) != 0 {
-			printParseErrors(out, monkeyParser.Errors())
+			printParseErrors(out, line, monkeyParser.Diagnostics())
 			continue
 		}
 
@@ -53,12 +71,25 @@ func Start(in io.Reader, out io.Writer) {
 
 		constants = code.Constants
 
+		if options.Optimize {
+			code = optimizer.Optimize(code)
+		}
+
 		machine := vm.NewWithGlobalStore(code, globals)
 
 		err = machine.Run()
 
+		// the store grows with the globals each line defines
+		globals = machine.Globals()
+
 		if err != nil {
 			fmt.Fprintf(out, "Whoops! Executing bytecode failed:\n %s\n", err)
+
+			var runtimeError *vm.RuntimeError
+			if errors.As(err, &runtimeError) {
+				io.WriteString(out, runtimeError.StackTrace.String())
+			}
+
 			continue
 		}
 
@@ -72,9 +103,38 @@ func Start(in io.Reader, out io.Writer) {
 
 }
 
-func printParseErrors(writer io.Writer, errors []string) {
-	for _, error := range errors {
-		_, _ = io.WriteString(writer, "\t"+error+"\n")
+func startEvaluator(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	env := object.NewEnvironment()
+
+	for {
+		fmt.Printf(PROMPT)
+		scanned := scanner.Scan()
+		if !scanned {
+			return
+		}
+
+		line := scanner.Text()
+		monkeyParser := parser.New(lexer.New(line))
+		program := monkeyParser.ParseProgram()
+
+		if len(monkeyParser.Errors()) != 0 {
+			printParseErrors(out, line, monkeyParser.Diagnostics())
+			continue
+		}
+
+		evaluated := evaluator.Eval(program, env)
+
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
+func printParseErrors(writer io.Writer, source string, diagnostics []parser.Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		_, _ = io.WriteString(writer, diagnostic.Render(source))
 		// no error handling apparently
 	}
 }
@@ -0,0 +1,48 @@
+package token
+
+import "fmt"
+
+// Position is a location in the source, as stamped by the lexer.
+// Line and Column start at 1, Offset is a byte offset starting at 0.
+// The zero value is an unknown position.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+func (self Position) IsValid() bool {
+	return self.Line > 0
+}
+
+// String returns "file:line:column", "line:column" when there is no file name,
+// or "-" when the position is unknown.
+func (self Position) String() string {
+	if !self.IsValid() {
+		if self.Filename != "" {
+			return self.Filename
+		}
+		return "-"
+	}
+
+	if self.Filename == "" {
+		return fmt.Sprintf("%d:%d", self.Line, self.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", self.Filename, self.Line, self.Column)
+}
+
+// Span is a half open range of source, End points just past the last byte.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (self Span) IsValid() bool {
+	return self.Start.IsValid()
+}
+
+func (self Span) String() string {
+	return fmt.Sprintf("%s-%d:%d", self.Start, self.End.Line, self.End.Column)
+}
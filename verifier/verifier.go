@@ -0,0 +1,342 @@
+// Package verifier checks the structure of bytecode before the VM runs it. The VM does not check operands or the depth
+// of the stack, bytecode read from a file or assembled by hand must go through Verify first.
+package verifier
+
+import (
+	"fmt"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/object"
+)
+
+// Error is the first problem Verify finds, in the main program or in the function at Constant in the constant pool
+type Error struct {
+	Function string // "main" or "constant 3"
+	Offset   int    // of the offending instruction
+	Message  string
+}
+
+func (self *Error) Error() string {
+	return fmt.Sprintf("%s at %04d: %s", self.Function, self.Offset, self.Message)
+}
+
+// Verify checks the main program and every compiled function of the constant pool:
+//   - every opcode is defined and has all its operands
+//   - constants, globals, builtins, locals and free variables are in range, OpClosure creates a compiled function
+//   - jumps land on the start of an instruction
+//   - the stack never goes below what a function pushed, has the same depth wherever paths meet,
+//     and a function returns instead of running past its last instruction
+//
+// It does not follow values: the VM reports a wrong type as a runtime error and reads a variable not set yet as null.
+func Verify(bytecode *compiler.ByteCode) error {
+	freeCounts, err := closureFreeCounts(bytecode)
+
+	if err != nil {
+		return err
+	}
+
+	main := &function{name: "main", instructions: bytecode.Instructions, isMain: true}
+
+	err = main.verify(bytecode)
+
+	if err != nil {
+		return err
+	}
+
+	for index, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+
+		if !ok {
+			continue
+		}
+
+		if fn.NumberOfParameters > fn.NumberOfLocals {
+			return &Error{Function: fmt.Sprintf("constant %d", index), Message: fmt.Sprintf(
+				"%d parameters do not fit in %d locals", fn.NumberOfParameters, fn.NumberOfLocals)}
+		}
+
+		freeCount, known := freeCounts[index]
+
+		verified := &function{
+			name:           fmt.Sprintf("constant %d", index),
+			instructions:   fn.Instructions,
+			numberOfLocals: fn.NumberOfLocals,
+			numberOfFree:   freeCount,
+			freeKnown:      known,
+		}
+
+		err = verified.verify(bytecode)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type function struct {
+	name           string
+	instructions   code.Instructions
+	isMain         bool
+	numberOfLocals int
+	numberOfFree   int
+	freeKnown      bool // a function no OpClosure creates may come from an earlier REPL line, its free variables are unknown
+}
+
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	offset   int
+	next     int // offset of the following instruction
+}
+
+func (self *function) fail(offset int, format string, a ...any) error {
+	return &Error{Function: self.name, Offset: offset, Message: fmt.Sprintf(format, a...)}
+}
+
+func (self *function) verify(bytecode *compiler.ByteCode) error {
+	instructions, err := self.decode()
+
+	if err != nil {
+		return err
+	}
+
+	for _, ins := range instructions {
+		err := self.checkOperands(ins, instructions, bytecode)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return self.checkStack(instructions)
+}
+
+// decode splits the instructions, by offset
+func (self *function) decode() (map[int]instruction, error) {
+	decoded := make(map[int]instruction)
+
+	for offset := 0; offset < len(self.instructions); {
+		definition, err := code.LookUp(self.instructions[offset])
+
+		if err != nil {
+			return nil, self.fail(offset, "%s", err)
+		}
+
+		if offset+definition.Width() > len(self.instructions) {
+			return nil, self.fail(offset, "%s is missing operands", definition.Name)
+		}
+
+		operands, read := code.ReadOperands(definition, self.instructions[offset+1:])
+		next := offset + 1 + read
+
+		decoded[offset] = instruction{op: code.Opcode(self.instructions[offset]), operands: operands, offset: offset, next: next}
+		offset = next
+	}
+
+	return decoded, nil
+}
+
+func (self *function) checkOperands(ins instruction, instructions map[int]instruction, bytecode *compiler.ByteCode) error {
+	switch ins.op {
+	case code.OpConstant:
+		if ins.operands[0] >= len(bytecode.Constants) {
+			return self.fail(ins.offset, "constant %d out of range, the pool has %d", ins.operands[0], len(bytecode.Constants))
+		}
+	case code.OpClosure:
+		if ins.operands[0] >= len(bytecode.Constants) {
+			return self.fail(ins.offset, "constant %d out of range, the pool has %d", ins.operands[0], len(bytecode.Constants))
+		}
+
+		if _, ok := bytecode.Constants[ins.operands[0]].(*object.CompiledFunction); !ok {
+			return self.fail(ins.offset, "constant %d is not a function", ins.operands[0])
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		target := ins.operands[0]
+
+		// the main program may jump to its end, out of a loop that ends it
+		if _, ok := instructions[target]; !ok && !(self.isMain && target == len(self.instructions)) {
+			return self.fail(ins.offset, "jump target %04d is not the start of an instruction", target)
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if ins.operands[0] >= bytecode.NumberOfGlobals {
+			return self.fail(ins.offset, "global %d out of range, the program has %d", ins.operands[0], bytecode.NumberOfGlobals)
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCell:
+		if ins.operands[0] >= self.numberOfLocals {
+			return self.fail(ins.offset, "local %d out of range, the function has %d", ins.operands[0], self.numberOfLocals)
+		}
+	case code.OpGetFree, code.OpSetFree, code.OpGetFreeCell:
+		if self.isMain {
+			return self.fail(ins.offset, "the main program has no free variables")
+		}
+
+		if self.freeKnown && ins.operands[0] >= self.numberOfFree {
+			return self.fail(ins.offset, "free variable %d out of range, the closure has %d", ins.operands[0], self.numberOfFree)
+		}
+	case code.OpGetBuiltin:
+		if ins.operands[0] >= len(object.Builtins) {
+			return self.fail(ins.offset, "builtin %d out of range, there are %d", ins.operands[0], len(object.Builtins))
+		}
+	case code.OpHash:
+		if ins.operands[0]%2 != 0 {
+			return self.fail(ins.offset, "a hash needs as many keys as values, got %d elements", ins.operands[0])
+		}
+	case code.OpReturnValue, code.OpReturn:
+		if self.isMain {
+			return self.fail(ins.offset, "the main program cannot return")
+		}
+	case code.OpTailCall:
+		if self.isMain {
+			return self.fail(ins.offset, "the main program cannot tail call, it has no caller to return to")
+		}
+	}
+
+	return nil
+}
+
+// stackEffect is how many values an instruction pops, then pushes
+func stackEffect(ins instruction) (int, int) {
+	switch ins.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal, code.OpGetLocal,
+		code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure, code.OpGetLocalCell, code.OpGetFreeCell:
+		return 0, 1
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpEqual, code.OpNotEqual,
+		code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpIterable:
+		return 1, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpSetFree, code.OpReturnValue:
+		return 1, 0
+	case code.OpArray, code.OpHash:
+		return ins.operands[0], 1
+	case code.OpCall, code.OpTailCall:
+		return ins.operands[0] + 1, 1
+	case code.OpClosure:
+		return ins.operands[1], 1
+	case code.OpSetIndex:
+		return 3, 1
+	case code.OpDup:
+		return ins.operands[0], 2 * ins.operands[0]
+	default:
+		return 0, 0
+	}
+}
+
+// checkStack follows every path from the first instruction with the depth of the stack above the locals
+func (self *function) checkStack(instructions map[int]instruction) error {
+	depths := map[int]int{0: 0}
+	worklist := []int{0}
+
+	// an empty function runs past its end right away
+	if len(self.instructions) == 0 {
+		if self.isMain {
+			return nil
+		}
+
+		return self.fail(0, "the function runs past its last instruction without returning")
+	}
+
+	for len(worklist) > 0 {
+		offset := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		ins := instructions[offset]
+		depth := depths[offset]
+
+		pops, pushes := stackEffect(ins)
+
+		if depth < pops {
+			return self.fail(offset, "pops %d values, the stack has %d", pops, depth)
+		}
+
+		depth = depth - pops + pushes
+
+		var successors []int
+
+		switch ins.op {
+		case code.OpReturnValue, code.OpReturn:
+		case code.OpJump:
+			successors = []int{ins.operands[0]}
+		case code.OpJumpNotTruthy:
+			successors = []int{ins.next, ins.operands[0]}
+		default:
+			successors = []int{ins.next}
+		}
+
+		for _, successor := range successors {
+			if successor == len(self.instructions) {
+				if !self.isMain {
+					return self.fail(offset, "the function runs past its last instruction without returning")
+				}
+				continue
+			}
+
+			known, ok := depths[successor]
+
+			if !ok {
+				depths[successor] = depth
+				worklist = append(worklist, successor)
+				continue
+			}
+
+			if known != depth {
+				return self.fail(successor, "the stack holds %d values on one path and %d on another", known, depth)
+			}
+		}
+	}
+
+	return nil
+}
+
+// closureFreeCounts finds how many free variables each function gets, from the OpClosure instructions creating it
+func closureFreeCounts(bytecode *compiler.ByteCode) (map[int]int, error) {
+	freeCounts := make(map[int]int)
+
+	scan := func(name string, instructions code.Instructions) error {
+		for offset := 0; offset < len(instructions); {
+			definition, err := code.LookUp(instructions[offset])
+
+			// decode reports it with the right function and offset
+			if err != nil || offset+definition.Width() > len(instructions) {
+				return nil
+			}
+
+			operands, read := code.ReadOperands(definition, instructions[offset+1:])
+
+			if code.Opcode(instructions[offset]) == code.OpClosure {
+				known, ok := freeCounts[operands[0]]
+
+				if ok && known != operands[1] {
+					return &Error{Function: name, Offset: offset, Message: fmt.Sprintf(
+						"constant %d is created with %d free variables here and %d elsewhere", operands[0], operands[1], known)}
+				}
+
+				freeCounts[operands[0]] = operands[1]
+			}
+
+			offset += 1 + read
+		}
+
+		return nil
+	}
+
+	err := scan("main", bytecode.Instructions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for index, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			err := scan(fmt.Sprintf("constant %d", index), fn.Instructions)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return freeCounts, nil
+}
@@ -0,0 +1,142 @@
+package verifier
+
+import (
+	"github.com/Neal-C/compiler-in-go/assembler"
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/compiler"
+	"github.com/Neal-C/compiler-in-go/lexer"
+	"github.com/Neal-C/compiler-in-go/object"
+	"github.com/Neal-C/compiler-in-go/optimizer"
+	"github.com/Neal-C/compiler-in-go/parser"
+	"testing"
+)
+
+// TestVerifyCompiledPrograms checks that what the compiler and the optimizer produce is accepted
+func TestVerifyCompiledPrograms(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3; -4; !true; 1.5 >= 2",
+		`let h = {"a": 1, 2: [1, 2, 3]}; h["a"]; h[2][0]`,
+		"if (1 > 2) { 10 } else { 20 }; if (false) { 1 }",
+		"let fib = fn(x) { if (x < 2) { return x; } fib(x - 1) + fib(x - 2) }; fib(10)",
+		"let adder = fn(a) { fn(b) { a += b; a } }; adder(1)(2)",
+		"let f = fn() { let x = 1; let g = fn() { x = x + 1; fn() { x } }; g() }; f()()",
+		"let i = 0; while (i < 10) { i += 1; if (i == 5) { break; } if (i == 2) { continue; } }; i",
+		"let n = 0; for (x in [1, 2, 3]) { if (x == 2) { continue; } n += x; }",
+		`let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } 0 }; f([1, 2])`,
+		`let a = [1, 2]; a[0] = 3; a[1] += 4; let h = {}; h["k"] = 1;`,
+		`puts(len("abc"), first([1]), rest([1, 2]))`,
+		"let f = fn() { }; f(); let g = fn(x) { return; }; g(1)",
+		"while (true) { break; }",
+		"true && false || 1 < 2",
+		`if (true) { while (false) { } }; if (true) { let y = 1; } else { }; puts("ok")`,
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+
+		bytecode := myCompiler.ByteCode()
+
+		err = Verify(bytecode)
+
+		if err != nil {
+			t.Errorf("%q: compiled bytecode rejected: %s", input, err)
+		}
+
+		err = Verify(optimizer.Optimize(bytecode))
+
+		if err != nil {
+			t.Errorf("%q: optimized bytecode rejected: %s", input, err)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	tableTests := []struct {
+		source   string
+		expected string
+	}{
+		{"OpConstant 0", "main at 0000: constant 0 out of range, the pool has 0"},
+		{"== constants ==\n0: 1\n== main ==\nOpClosure 0 0", "main at 0000: constant 0 is not a function"},
+		{"OpTrue\nOpJumpNotTruthy 2\nOpNull", "main at 0001: jump target 0002 is not the start of an instruction"},
+		{"OpJump 100", "main at 0000: jump target 0100 is not the start of an instruction"},
+		{"OpGetLocal 0\nOpPop", "main at 0000: local 0 out of range, the function has 0"},
+		{"OpGetFree 0", "main at 0000: the main program has no free variables"},
+		{"OpGetBuiltin 200", "main at 0000: builtin 200 out of range, there are 16"},
+		{"OpTrue\nOpHash 1", "main at 0001: a hash needs as many keys as values, got 1 elements"},
+		{"OpReturn", "main at 0000: the main program cannot return"},
+		{
+			"OpClosure 0 0\nOpTailCall 0\nOpPop\n== constant 0: fn f, 0 parameters, 0 locals ==\nOpTrue\nOpReturnValue",
+			"main at 0004: the main program cannot tail call, it has no caller to return to",
+		},
+		{"OpPop", "main at 0000: pops 1 values, the stack has 0"},
+		{"OpTrue\nOpCall 1", "main at 0001: pops 2 values, the stack has 1"},
+		{"OpTrue\nOpJumpNotTruthy else\nOpTrue\nelse:\nOpNull", "main at 0005: the stack holds 0 values on one path and 1 on another"},
+		{
+			"OpClosure 0 0\nOpPop\n== constant 0: fn f, 0 parameters, 0 locals ==\nOpNull\nOpPop",
+			"constant 0 at 0001: the function runs past its last instruction without returning",
+		},
+		{
+			"OpClosure 0 0\nOpPop\n== constant 0: fn f, 0 parameters, 1 locals ==\nOpGetFree 0\nOpReturnValue",
+			"constant 0 at 0000: free variable 0 out of range, the closure has 0",
+		},
+		{
+			"OpNull\nOpClosure 0 1\nOpClosure 0 0\nOpPop\nOpPop\n== constant 0: fn f, 0 parameters, 0 locals ==\nOpReturn",
+			"main at 0005: constant 0 is created with 0 free variables here and 1 elsewhere",
+		},
+		{
+			"== constant 0: fn f, 2 parameters, 1 locals ==\nOpReturn",
+			"constant 0 at 0000: 2 parameters do not fit in 1 locals",
+		},
+	}
+
+	for _, tt := range tableTests {
+		bytecode, err := assembler.Assemble(tt.source)
+
+		if err != nil {
+			t.Fatalf("%q: assembler error: %s", tt.source, err)
+		}
+
+		err = Verify(bytecode)
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error.\nwant = %q\ngot  = %v", tt.source, tt.expected, err)
+		}
+	}
+}
+
+func TestVerifyMalformedInstructions(t *testing.T) {
+	tableTests := []struct {
+		instructions code.Instructions
+		expected     string
+	}{
+		{code.Instructions{255}, "main at 0000: opcode 255 undefined"},
+		{code.Instructions{byte(code.OpConstant), 0}, "main at 0000: OpConstant is missing operands"},
+		{concat(code.Make(code.OpGetGlobal, 3), code.Make(code.OpPop)), "main at 0000: global 3 out of range, the program has 0"},
+		{concat(code.Make(code.OpTrue), code.Make(code.OpSetGlobal, 0)), "main at 0001: global 0 out of range, the program has 0"},
+	}
+
+	for _, tt := range tableTests {
+		err := Verify(&compiler.ByteCode{Instructions: tt.instructions, Constants: []object.Object{}})
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error.\nwant = %q\ngot  = %v", tt.expected, err)
+		}
+	}
+}
+
+func concat(instructions ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+
+	return out
+}
@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// checkInterval is how many instructions run between two looks at the clock and the context,
+// time.Now and a select are too slow for every one
+const checkInterval = 1024
+
+// budget is what a VM may spend on Run, see Options.MaxInstructions, Options.Deadline and RunContext
+type budget struct {
+	maxInstructions int64
+	deadline        time.Time
+	done            <-chan struct{} // nil for a context that is never canceled
+	ctx             context.Context
+	executed        int64
+}
+
+// start begins a Run or a Call, MaxInstructions is for each of them
+func (self *budget) start(ctx context.Context) {
+	self.ctx = ctx
+	self.done = ctx.Done()
+	self.executed = 0
+}
+
+func (self *budget) isLimited() bool {
+	return self.maxInstructions > 0 || !self.deadline.IsZero() || self.done != nil
+}
+
+// spend accounts for one instruction about to be executed
+func (self *budget) spend() error {
+	self.executed++
+
+	if self.maxInstructions > 0 && self.executed > self.maxInstructions {
+		return fmt.Errorf("%w: more than %d instructions", ErrBudgetExceeded, self.maxInstructions)
+	}
+
+	if self.executed%checkInterval != 0 {
+		return nil
+	}
+
+	if !self.deadline.IsZero() && time.Now().After(self.deadline) {
+		return fmt.Errorf("%w: deadline passed", ErrBudgetExceeded)
+	}
+
+	select {
+	case <-self.done:
+		return self.ctx.Err()
+	default:
+		return nil
+	}
+}
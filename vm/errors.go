@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Neal-C/compiler-in-go/code"
+	"github.com/Neal-C/compiler-in-go/token"
+)
+
+const (
+	MainFunctionName      = "<main>"
+	AnonymousFunctionName = "<anonymous>"
+)
+
+// ErrMaxCallDepth is the error of a RuntimeError when calls nest deeper than the frames or the stack of the VM allow,
+// ErrStackOverflow when the main program alone fills the stack
+var (
+	ErrMaxCallDepth  = errors.New("maximum call depth exceeded")
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
+// ErrBudgetExceeded is the error of a RuntimeError when Run goes past Options.MaxInstructions or Options.Deadline
+var ErrBudgetExceeded = errors.New("execution budget exceeded")
+
+// RuntimeError is returned by Run when executing the bytecode fails.
+// Position is the source position of the failing instruction, when the bytecode carries a source map.
+// StackTrace holds the frames that were active at the time, innermost first.
+type RuntimeError struct {
+	Position   token.Position
+	Err        error
+	StackTrace StackTrace
+}
+
+func (self *RuntimeError) Error() string {
+	if !self.Position.IsValid() {
+		return self.Err.Error()
+	}
+
+	return fmt.Sprintf("%s: %s", self.Position, self.Err)
+}
+
+func (self *RuntimeError) Unwrap() error {
+	return self.Err
+}
+
+// StackFrame is one active call at the time of a runtime error
+type StackFrame struct {
+	Function    string
+	Instruction int // offset of the instruction being executed in the function
+	Position    token.Position
+}
+
+func (self StackFrame) String() string {
+	return fmt.Sprintf("at %s (%s) [ip %04d]", self.Function, self.Position, self.Instruction)
+}
+
+type StackTrace []StackFrame
+
+// printedFrames bounds how much of a deep stack trace String prints, half from each end
+const printedFrames = 20
+
+// String prints one frame per line, innermost first, the way the REPL shows it.
+// The middle of a trace too deep to read, after a maximum call depth exceeded, is left out.
+func (self StackTrace) String() string {
+	var out bytes.Buffer
+
+	for index, frame := range self {
+		if len(self) > printedFrames && index == printedFrames/2 {
+			out.WriteString(fmt.Sprintf("\t... %d more frames\n", len(self)-printedFrames))
+		}
+
+		if len(self) > printedFrames && index >= printedFrames/2 && index < len(self)-printedFrames/2 {
+			continue
+		}
+
+		out.WriteString("\t" + frame.String() + "\n")
+	}
+
+	return out.String()
+}
+
+func (self *VM) newRuntimeError(err error) *RuntimeError {
+	// a closure a builtin called back failed, the error already points into it
+	if runtimeError, ok := err.(*RuntimeError); ok {
+		return runtimeError
+	}
+
+	stackTrace := self.StackTrace()
+
+	return &RuntimeError{Position: stackTrace[0].Position, Err: err, StackTrace: stackTrace}
+}
+
+// StackTrace is the frames active right now, innermost first.
+// After Run or RunContext fail they are the ones active at the failure.
+func (self *VM) StackTrace() StackTrace {
+	stackTrace := make(StackTrace, 0, self.framesIndex)
+
+	for i := self.framesIndex - 1; i >= 0; i-- {
+		stackTrace = append(stackTrace, self.frames[i].stackFrame(i == 0))
+	}
+
+	return stackTrace
+}
+
+func (self *Frame) stackFrame(isMain bool) StackFrame {
+	fn := self.closureFn.Fn
+
+	name := fn.Name
+
+	if isMain {
+		name = MainFunctionName
+	} else if name == "" {
+		name = AnonymousFunctionName
+	}
+
+	position, _ := fn.SourceMap.Lookup(self.indexPointer)
+
+	return StackFrame{
+		Function:    name,
+		Instruction: instructionStart(fn.Instructions, self.indexPointer),
+		Position:    position,
+	}
+}
+
+// instructionStart finds the beginning of the instruction covering offset,
+// the index pointer of a frame may already have moved on to its operands
+func instructionStart(instructions code.Instructions, offset int) int {
+	start := 0
+
+	for index := 0; index <= offset && index < len(instructions); {
+		start = index
+
+		definition, err := code.LookUp(instructions[index])
+
+		if err != nil {
+			return offset
+		}
+
+		index++
+
+		for _, width := range definition.OperandsWidth {
+			index += width
+		}
+	}
+
+	return start
+}
@@ -1,19 +1,30 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Neal-C/compiler-in-go/code"
 	"github.com/Neal-C/compiler-in-go/compiler"
 	"github.com/Neal-C/compiler-in-go/object"
+	"math"
+	"time"
 )
 
+// StackSize and MaxFrames are the default ceilings, see Options to change them for one VM.
+// The stack and the frames start small and grow on demand up to them.
 const StackSize = 2048
-const GlobalSize = 65536
 const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+// GlobalSize is the most globals a program can define, OpGetGlobal and OpSetGlobal have a 2-byte operand
+const GlobalSize = 65536
+
+const initialStackSize = 64
+const initialFrames = 16
+
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type VM struct {
 	constants    []object.Object
@@ -22,6 +33,9 @@ type VM struct {
 	globals      []object.Object
 	frames       []*Frame
 	framesIndex  int
+	maxStackSize int
+	maxFrames    int
+	budget       budget
 }
 
 type Frame struct {
@@ -42,29 +56,71 @@ func (self *Frame) Instructions() code.Instructions {
 	return self.closureFn.Fn.Instructions
 }
 
+// Options tunes a VM, a zero field keeps the default
+type Options struct {
+	StackSize int // most slots the stack grows to, for locals and operands, StackSize by default
+	MaxFrames int // most nested calls, MaxFrames by default
+
+	// for untrusted scripts, Run and Call fail with ErrBudgetExceeded past either limit
+	MaxInstructions int64     // most instructions one Run or one Call executes, no limit when zero
+	Deadline        time.Time // wall-clock time Run must finish by, no limit when zero
+
+	Globals []object.Object // the global store of a previous run, see NewWithGlobalStore
+}
+
 func New(bytecode *compiler.ByteCode) *VM {
+	return NewWithOptions(bytecode, Options{})
+}
+
+func NewWithOptions(bytecode *compiler.ByteCode, options Options) *VM {
+
+	if options.StackSize <= 0 {
+		options.StackSize = StackSize
+	}
+
+	if options.MaxFrames <= 0 {
+		options.MaxFrames = MaxFrames
+	}
+
+	globals := options.Globals
+
+	if globals == nil {
+		globals = make([]object.Object, bytecode.NumberOfGlobals)
+	}
 
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, 1, min(initialFrames, options.MaxFrames))
 	frames[0] = mainFrame
 
-	return &VM{
+	vm := &VM{
 		constants:    bytecode.Constants,
-		stack:        make([]object.Object, StackSize),
+		stack:        make([]object.Object, min(initialStackSize, options.StackSize)),
 		stackPointer: 0,
-		globals:      make([]object.Object, GlobalSize),
+		globals:      globals,
 		frames:       frames,
 		framesIndex:  1,
+		maxStackSize: options.StackSize,
+		maxFrames:    options.MaxFrames,
+		budget:       budget{maxInstructions: options.MaxInstructions, deadline: options.Deadline},
 	}
+
+	vm.growGlobals(bytecode.NumberOfGlobals)
+
+	return vm
 }
 
+// NewWithGlobalStore runs bytecode against the globals of a previous run, the way the REPL does.
+// A program that defines more globals than globals holds gets a larger copy, see Globals.
 func NewWithGlobalStore(bytecode *compiler.ByteCode, globals []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = globals
-	return vm
+	return NewWithOptions(bytecode, Options{Globals: globals})
+}
+
+// Globals is the global store, to hand over to NewWithGlobalStore for the next run
+func (self *VM) Globals() []object.Object {
+	return self.globals
 }
 
 func (self *VM) StackTop() object.Object {
@@ -75,16 +131,93 @@ func (self *VM) StackTop() object.Object {
 	return self.stack[self.stackPointer-1]
 }
 
+// Run executes the bytecode, failures come back as a *RuntimeError pointing at the failing instruction
 func (self *VM) Run() error {
+	return self.RunContext(context.Background())
+}
+
+// RunContext is Run, stopping with a *RuntimeError wrapping ctx.Err() once ctx is done.
+// The stack and the frames are left as they were when it stopped, see StackTrace.
+func (self *VM) RunContext(ctx context.Context) error {
+	self.budget.start(ctx)
+
+	err := self.run(0)
+
+	if err != nil {
+		return self.newRuntimeError(err)
+	}
+
+	return nil
+}
+
+// Call applies a closure or a builtin to args and returns its result, on a VM that is done running,
+// for a host calling back a function the program handed over. It uses the globals of the VM.
+func (self *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return self.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is Call, stopping with a *RuntimeError wrapping ctx.Err() once ctx is done.
+// On failure the stack and the frames go back to what they were before the call, the VM can be called again.
+func (self *VM) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	self.budget.start(ctx)
+
+	return caller{vm: self}.Call(fn, args...)
+}
+
+// call pushes fn and args, then runs until the frame of fn returns
+func (self *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	framesIndex := self.framesIndex
+
+	err := self.push(fn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		err := self.push(arg)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = self.executeCall(len(args))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a builtin is done already, a closure has a frame to run
+	err = self.run(framesIndex)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return self.pop(), nil
+}
+
+// run executes instructions until the frames go down to stopAt, a call from Go returning,
+// or the main program reaches its end
+func (self *VM) run(stopAt int) error {
 
 	var indexPointer int
 	var instructions code.Instructions
 	var op code.Opcode
 
-	for self.currentFrame().indexPointer < len(self.currentFrame().Instructions())-1 {
+	for self.framesIndex > stopAt && self.currentFrame().indexPointer < len(self.currentFrame().Instructions())-1 {
 
 		self.currentFrame().indexPointer++
 
+		if self.budget.isLimited() {
+			err := self.budget.spend()
+
+			if err != nil {
+				return err
+			}
+		}
+
 		indexPointer = self.currentFrame().indexPointer
 
 		instructions = self.currentFrame().Instructions()
@@ -109,7 +242,7 @@ func (self *VM) Run() error {
 
 			self.pop()
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
 			err := self.executeBinaryOperation(op)
 
 			if err != nil {
@@ -130,7 +263,7 @@ func (self *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
 			err := self.executeComparison(op)
 
 			if err != nil {
@@ -181,6 +314,9 @@ func (self *VM) Run() error {
 
 			self.currentFrame().indexPointer += 2
 
+			// bytecode built by hand may not say how many globals it defines
+			self.growGlobals(int(globalIndex) + 1)
+
 			self.globals[globalIndex] = self.pop()
 
 		case code.OpGetGlobal:
@@ -189,9 +325,13 @@ func (self *VM) Run() error {
 
 			self.currentFrame().indexPointer += 2
 
-			resolvedValue := self.globals[globalIndex]
+			var resolvedValue object.Object
+
+			if int(globalIndex) < len(self.globals) {
+				resolvedValue = self.globals[globalIndex]
+			}
 
-			err := self.push(resolvedValue)
+			err := self.pushVariable(resolvedValue)
 
 			if err != nil {
 				return err
@@ -243,6 +383,33 @@ func (self *VM) Run() error {
 				return err
 			}
 
+		case code.OpSetIndex:
+
+			value := self.pop()
+			index := self.pop()
+			left := self.pop()
+
+			err := self.executeSetIndexOperation(left, index, value)
+
+			if err != nil {
+				return err
+			}
+
+		case code.OpDup:
+
+			count := int(code.ReadUint8(instructions[indexPointer+1:]))
+			self.currentFrame().indexPointer += 1
+
+			start := self.stackPointer - count
+
+			for i := start; i < start+count; i++ {
+				err := self.push(self.stack[i])
+
+				if err != nil {
+					return err
+				}
+			}
+
 		case code.OpCall:
 
 			numberOfArguments := code.ReadUint8(instructions[indexPointer+1:])
@@ -255,6 +422,18 @@ func (self *VM) Run() error {
 				return err
 			}
 
+		case code.OpTailCall:
+
+			numberOfArguments := code.ReadUint8(instructions[indexPointer+1:])
+
+			self.currentFrame().indexPointer += 1
+
+			err := self.executeTailCall(int(numberOfArguments))
+
+			if err != nil {
+				return err
+			}
+
 		case code.OpReturnValue:
 
 			returnValue := self.pop()
@@ -287,7 +466,14 @@ func (self *VM) Run() error {
 
 			frame := self.currentFrame()
 
-			self.stack[frame.basePointer+int(localIndex)] = self.pop()
+			slot := &self.stack[frame.basePointer+int(localIndex)]
+
+			// a captured local lives in a cell, the closures that captured it must see the new value
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = self.pop()
+			} else {
+				*slot = self.pop()
+			}
 
 		case code.OpGetLocal:
 
@@ -299,7 +485,11 @@ func (self *VM) Run() error {
 
 			localBinding := self.stack[frame.basePointer+int(localIndex)]
 
-			err := self.push(localBinding)
+			if cell, ok := localBinding.(*object.Cell); ok {
+				localBinding = cell.Value
+			}
+
+			err := self.pushVariable(localBinding)
 
 			if err != nil {
 				return err
@@ -339,12 +529,73 @@ func (self *VM) Run() error {
 
 			currentClosure := self.currentFrame().closureFn
 
+			err := self.pushVariable(currentClosure.Free[freeIndex].Value)
+
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+
+			freeIndex := code.ReadUint8(instructions[indexPointer+1:])
+			self.currentFrame().indexPointer += 1
+
+			currentClosure := self.currentFrame().closureFn
+
+			currentClosure.Free[freeIndex].Value = self.pop()
+
+		case code.OpGetLocalCell:
+
+			localIndex := code.ReadUint8(instructions[indexPointer+1:])
+			self.currentFrame().indexPointer += 1
+
+			frame := self.currentFrame()
+
+			slot := &self.stack[frame.basePointer+int(localIndex)]
+
+			// the first capture moves the local into a cell, later ones share it
+			cell, ok := (*slot).(*object.Cell)
+
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+
+			err := self.push(cell)
+
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFreeCell:
+
+			freeIndex := code.ReadUint8(instructions[indexPointer+1:])
+			self.currentFrame().indexPointer += 1
+
+			currentClosure := self.currentFrame().closureFn
+
 			err := self.push(currentClosure.Free[freeIndex])
 
 			if err != nil {
 				return err
 			}
 
+		case code.OpIterable:
+
+			iterable := self.pop()
+
+			items, ok := object.IterableItems(iterable)
+
+			if !ok {
+				return fmt.Errorf("cannot iterate over : %s", iterable.Type())
+			}
+
+			err := self.push(&object.Array{Elements: items})
+
+			if err != nil {
+				return err
+			}
+
 		case code.OpCurrentClosure:
 			currentClosure := self.currentFrame().closureFn
 			err := self.push(currentClosure)
@@ -359,8 +610,13 @@ func (self *VM) Run() error {
 
 func (self *VM) push(obj object.Object) error {
 
-	if self.stackPointer >= StackSize {
-		return fmt.Errorf("stack overflow : https://stackoverflow.com/")
+	if self.stackPointer >= len(self.stack) && !self.growStack(self.stackPointer+1) {
+		// inside a call, running out of stack is recursion going too deep
+		if self.framesIndex > 1 {
+			return ErrMaxCallDepth
+		}
+
+		return ErrStackOverflow
 	}
 
 	self.stack[self.stackPointer] = obj
@@ -389,6 +645,8 @@ func (self *VM) executeBinaryOperation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return self.executeBinaryIntegerOperation(op, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		return self.executeBinaryFloatOperation(op, object.ToFloat(left), object.ToFloat(right))
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return self.executeBinaryStringOperation(op, left, right)
 	default:
@@ -412,13 +670,42 @@ func (self *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue % rightValue
 	default:
 		return fmt.Errorf("unknown integer operation: %d", op)
 	}
 	return self.push(&object.Integer{Value: result})
 }
 
+// executeBinaryFloatOperation handles floats, and integers mixed with floats
+func (self *VM) executeBinaryFloatOperation(op code.Opcode, leftValue float64, rightValue float64) error {
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown float operation: %d", op)
+	}
+	return self.push(&object.Float{Value: result})
+}
+
 func (self *VM) executeComparison(op code.Opcode) error {
 	rightHandSign := self.pop()
 	leftHandSign := self.pop()
@@ -427,11 +714,15 @@ func (self *VM) executeComparison(op code.Opcode) error {
 		return self.executeIntegerComparison(op, leftHandSign, rightHandSign)
 	}
 
+	if object.IsNumber(leftHandSign) && object.IsNumber(rightHandSign) {
+		return self.executeFloatComparison(op, object.ToFloat(leftHandSign), object.ToFloat(rightHandSign))
+	}
+
 	switch op {
 	case code.OpEqual:
-		return self.push(nativeBoolToBooleanObject(leftHandSign == rightHandSign))
+		return self.push(nativeBoolToBooleanObject(object.Equal(leftHandSign, rightHandSign)))
 	case code.OpNotEqual:
-		return self.push(nativeBoolToBooleanObject(leftHandSign != rightHandSign))
+		return self.push(nativeBoolToBooleanObject(!object.Equal(leftHandSign, rightHandSign)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, leftHandSign.Type(), rightHandSign.Type())
 	}
@@ -448,6 +739,24 @@ func (self *VM) executeIntegerComparison(op code.Opcode, leftHandSign object.Obj
 		return self.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return self.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return self.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unkown op: %d", op)
+
+	}
+}
+
+func (self *VM) executeFloatComparison(op code.Opcode, leftValue float64, rightValue float64) error {
+	switch op {
+	case code.OpEqual:
+		return self.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return self.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return self.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return self.push(nativeBoolToBooleanObject(leftValue >= rightValue))
 	default:
 		return fmt.Errorf("unkown op: %d", op)
 
@@ -480,13 +789,14 @@ func (self *VM) executeBangOperator() error {
 func (self *VM) executeMinusOperator() error {
 	operandee := self.pop()
 
-	if operandee.Type() != object.INTEGER_OBJ {
+	switch operandee := operandee.(type) {
+	case *object.Integer:
+		return self.push(&object.Integer{Value: -operandee.Value})
+	case *object.Float:
+		return self.push(&object.Float{Value: -operandee.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operandee.Type())
 	}
-
-	value := operandee.(*object.Integer).Value
-
-	return self.push(&object.Integer{Value: -value})
 }
 
 func isTruthy(obj object.Object) bool {
@@ -588,13 +898,81 @@ func (self *VM) executeHashIndex(hash object.Object, index object.Object) error
 
 }
 
+// executeSetIndexOperation mutates the array or hash in place, every reference to it sees the change
+func (self *VM) executeSetIndexOperation(left object.Object, index object.Object, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+
+		if !ok {
+			return fmt.Errorf("array index must be an INTEGER, got : %s", index.Type())
+		}
+
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range : %d (length %d)", idx.Value, len(left.Elements))
+		}
+
+		left.Elements[idx.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+
+		if !ok {
+			return fmt.Errorf("unusable as a key: %s", index.Type())
+		}
+
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported for : %s", left.Type())
+	}
+
+	return self.push(value)
+}
+
 func (self *VM) currentFrame() *Frame {
 	return self.frames[self.framesIndex-1]
 }
 
-func (self *VM) pushFrame(frame *Frame) {
-	self.frames[self.framesIndex] = frame
+func (self *VM) pushFrame(frame *Frame) error {
+	if self.framesIndex >= self.maxFrames {
+		return ErrMaxCallDepth
+	}
+
+	if self.framesIndex < len(self.frames) {
+		self.frames[self.framesIndex] = frame
+	} else {
+		self.frames = append(self.frames, frame)
+	}
+
 	self.framesIndex++
+
+	return nil
+}
+
+// growStack makes room for size slots, it reports false past maxStackSize
+func (self *VM) growStack(size int) bool {
+	if size <= len(self.stack) {
+		return true
+	}
+
+	if size > self.maxStackSize {
+		return false
+	}
+
+	stack := make([]object.Object, min(max(2*len(self.stack), size), self.maxStackSize))
+	copy(stack, self.stack)
+	self.stack = stack
+
+	return true
+}
+
+func (self *VM) growGlobals(size int) {
+	if size <= len(self.globals) {
+		return
+	}
+
+	globals := make([]object.Object, size)
+	copy(globals, self.globals)
+	self.globals = globals
 }
 
 func (self *VM) popFrame() *Frame {
@@ -611,9 +989,23 @@ func (self *VM) callClosure(closure *object.Closure, numberOfArguments int) erro
 
 	newFrame := NewFrame(closure, self.stackPointer-numberOfArguments)
 
-	self.pushFrame(newFrame)
+	if !self.growStack(newFrame.basePointer + closure.Fn.NumberOfLocals) {
+		return ErrMaxCallDepth
+	}
+
+	err := self.pushFrame(newFrame)
+
+	if err != nil {
+		return err
+	}
+
 	self.stackPointer = newFrame.basePointer + closure.Fn.NumberOfLocals
 
+	// a previous call may have left cells in these slots, OpSetLocal would write through them
+	for i := newFrame.basePointer + numberOfArguments; i < self.stackPointer; i++ {
+		self.stack[i] = nil
+	}
+
 	return nil
 }
 
@@ -631,9 +1023,67 @@ func (self *VM) executeCall(numberOfArguments int) error {
 	}
 }
 
+// executeTailCall runs a closure in the frame of the caller: the callee and its arguments move down
+// to where the caller's callee was, so recursion in tail position does not grow the stack or the frames.
+// The OpReturnValue that follows the call in the caller is never reached, the callee returns in its place.
+func (self *VM) executeTailCall(numberOfArguments int) error {
+
+	callee := self.stack[(self.stackPointer-1)-numberOfArguments]
+
+	closure, ok := callee.(*object.Closure)
+
+	// the main program has no caller to return in place of, only hand-written bytecode tail calls there
+	if !ok || self.framesIndex == 1 {
+		return self.executeCall(numberOfArguments)
+	}
+
+	if closure.Fn.NumberOfParameters != numberOfArguments {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			closure.Fn.NumberOfParameters, numberOfArguments)
+	}
+
+	basePointer := self.currentFrame().basePointer
+	calleeIndex := self.stackPointer - 1 - numberOfArguments
+
+	// a failing call must leave the frame of the caller intact, for the stack trace
+	if !self.growStack(basePointer + closure.Fn.NumberOfLocals) {
+		return ErrMaxCallDepth
+	}
+
+	copy(self.stack[basePointer-1:], self.stack[calleeIndex:self.stackPointer])
+
+	newFrame := NewFrame(closure, basePointer)
+
+	self.frames[self.framesIndex-1] = newFrame
+	self.stackPointer = newFrame.basePointer + closure.Fn.NumberOfLocals
+
+	for i := newFrame.basePointer + numberOfArguments; i < self.stackPointer; i++ {
+		self.stack[i] = nil
+	}
+
+	return nil
+}
+
+// pushVariable pushes the value of a global, a local or a free variable, null for one read before it is set, like x in let x = x
+func (self *VM) pushVariable(value object.Object) error {
+	if value == nil {
+		return self.push(Null)
+	}
+
+	return self.push(value)
+}
+
 func (self *VM) callBuiltin(callee *object.Builtin, numberOfArguments int) error {
-	args := self.stack[self.stackPointer-numberOfArguments : self.stackPointer]
-	result := callee.Fn(args...)
+	args := make([]object.Object, numberOfArguments)
+	copy(args, self.stack[self.stackPointer-numberOfArguments:self.stackPointer])
+
+	// the builtin may call back into the VM, above the arguments
+	result, err := callee.Call(caller{vm: self}, args...)
+
+	if err != nil {
+		return err
+	}
+
 	self.stackPointer = self.stackPointer - numberOfArguments - 1
 	if result != nil {
 		self.push(result)
@@ -643,6 +1093,36 @@ func (self *VM) callBuiltin(callee *object.Builtin, numberOfArguments int) error
 	return nil
 }
 
+// caller lets builtins like map apply closures in the VM running them, see object.Caller
+type caller struct {
+	vm *VM
+}
+
+// Call runs fn on top of the frames of the builtin's caller. A failure, an error returned by a builtin too, is turned into a *RuntimeError
+// while the frames of fn are still there for its stack trace, then the VM goes back to where the builtin called it.
+func (self caller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	framesIndex := self.vm.framesIndex
+	stackPointer := self.vm.stackPointer
+
+	result, err := self.vm.call(fn, args)
+
+	// a builtin fails by returning an error, the same failure as a closure's
+	if errorObject, ok := result.(*object.Error); ok && err == nil {
+		err = errors.New(errorObject.Message)
+	}
+
+	if err != nil {
+		runtimeError := self.vm.newRuntimeError(err)
+
+		self.vm.framesIndex = framesIndex
+		self.vm.stackPointer = stackPointer
+
+		return nil, runtimeError
+	}
+
+	return result, nil
+}
+
 func (self *VM) pushClosure(constantIndex int, numberOfFreeVariables int) error {
 	constant := self.constants[constantIndex]
 
@@ -652,10 +1132,19 @@ func (self *VM) pushClosure(constantIndex int, numberOfFreeVariables int) error
 		return fmt.Errorf("not a function: %v", constant)
 	}
 
-	freeVariables := make([]object.Object, numberOfFreeVariables)
+	freeVariables := make([]*object.Cell, numberOfFreeVariables)
 
 	for i := 0; i < numberOfFreeVariables; i++ {
-		freeVariables[i] = self.stack[self.stackPointer-numberOfFreeVariables+i]
+		freeVariable := self.stack[self.stackPointer-numberOfFreeVariables+i]
+
+		// cells come from OpGetLocalCell and OpGetFreeCell, anything else (the current closure) gets its own
+		cell, ok := freeVariable.(*object.Cell)
+
+		if !ok {
+			cell = &object.Cell{Value: freeVariable}
+		}
+
+		freeVariables[i] = cell
 	}
 
 	self.stackPointer = self.stackPointer - numberOfFreeVariables
@@ -1,10 +1,15 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/Neal-C/compiler-in-go/assembler"
 	"github.com/Neal-C/compiler-in-go/ast"
 	"github.com/Neal-C/compiler-in-go/compiler"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Neal-C/compiler-in-go/lexer"
 	"github.com/Neal-C/compiler-in-go/object"
@@ -90,6 +95,12 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 		if err != nil {
 			t.Errorf("testIntegerObject failed %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+
+		if err != nil {
+			t.Errorf("testFloatObject failed %s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 
@@ -240,6 +251,41 @@ func testBooleanObject(expected bool, actual object.Object) error {
 	return nil
 }
 
+func TestStructuralEquality(t *testing.T) {
+	testTable := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[] == []`, true},
+		{`[1, [2, "three"]] == [1, [2, "three"]]`, true},
+		{`[1, [2, "three"]] == [1, [2, "four"]]`, false},
+		{`[1] == [1.0]`, true},
+		{`[1] == ["1"]`, false},
+		{`[true] == [true]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{1: "one"} != {1: "one"}`, false},
+		{`[1] == {0: 1}`, false},
+		{`"1" == 1`, false},
+		{`let a = [1]; a[0] = a; a == a`, true},
+		{`let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b`, true},
+		{`let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a != b`, true},
+		{`let h = {"n": 1}; h["self"] = h; let g = {"n": 1}; g["self"] = g; h == g`, true},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`len == len`, true},
+	}
+
+	runVmTests(t, testTable)
+}
+
 func TestConditionals(t *testing.T) {
 	testTable := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -262,6 +308,10 @@ func TestGlobalLetStatements(t *testing.T) {
 		{"let one = 1; one;", 1},
 		{"let one = 1; let two = 2; one + two;", 3},
 		{"let one = 1; let two = one + one; one + two;", 3},
+		{"let x = x; x", Null},
+		{"let x = x == 1; x", false},
+		{"let f = fn() { let y = y; y }; f()", Null},
+		{"let g = fn() { let z = z; fn() { z } }; g()()", Null},
 	}
 
 	runVmTests(t, testTable)
@@ -568,15 +618,15 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	testTable := []vmTestCase{
 		{
 			input:    `fn() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
+			expected: `1:12: wrong number of arguments: want=0, got=1`,
 		},
 		{
 			input:    `fn(a) { a; }();`,
-			expected: `wrong number of arguments: want=1, got=0`,
+			expected: `1:13: wrong number of arguments: want=1, got=0`,
 		},
 		{
 			input:    `fn(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
+			expected: `1:20: wrong number of arguments: want=2, got=1`,
 		},
 	}
 
@@ -652,6 +702,125 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, testTable)
 }
 
+// TestCallbackBuiltins runs the builtins that call back into the VM, evaluator.TestCallbackBuiltins has the same table
+func TestCallbackBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // inspected
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, "[11, 12]"},
+		{`map(["a", "bb"], len)`, "[1, 2]"},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; map([3, 4], fact)`, "[6, 24]"},
+		{`map([[1, 2], [3]], fn(xs) { reduce(xs, 0, fn(a, b) { a + b }) })`, "[3, 3]"},
+		{`let double = fn(xs) { map(xs, fn(x) { x * 2 }) }; double([1, 2])`, "[2, 4]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`filter([0, 1, false, true], fn(x) { x })`, "[0, 1, true]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`let sum = 0; each([1, 2, 3], fn(x) { sum += x }); sum`, "6"},
+		{`each([1], fn(x) { x })`, "null"},
+		{`find([1, 5, 10], fn(x) { x > 3 })`, "5"},
+		{`find([1, 2], fn(x) { x > 3 })`, "null"},
+		{`any([1, 2], fn(x) { x > 1 })`, "true"},
+		{`any([], fn(x) { true })`, "false"},
+		{`all([1, 2], fn(x) { x > 0 })`, "true"},
+		{`all([], fn(x) { false })`, "true"},
+		{`!all([1, 2], fn(x) { x > 1 })`, "true"},
+		{`any([1], fn(x) { false }) == false`, "true"},
+		{`sort_by([3, 1, 2], fn(x) { x })`, "[1, 2, 3]"},
+		{`sort_by(["bb", "a", "ccc"], len)`, "[a, bb, ccc]"},
+		{`sort_by([2, 1.5, 1], fn(x) { x })`, "[1, 1.5, 2]"},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], fn(pair) { pair[0] })`, "[[1, b], [2, a], [2, c]]"},
+		{`map(1, fn(x) { x })`, "ERROR: first argument to map must be an ARRAY, got INTEGER"},
+		{`filter([1], 2)`, "ERROR: last argument to filter must be a function, got INTEGER"},
+		{`reduce([1], fn(a, b) { a })`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`sort_by([1, "a"], fn(x) { x })`, "ERROR: sort_by keys must all be numbers or all be strings, got INTEGER and STRING"},
+	}
+
+	for _, tt := range tests {
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("%s: compiler error: %s", tt.input, err)
+		}
+
+		machine := New(myCompiler.ByteCode())
+
+		err = machine.Run()
+
+		if err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+
+		if got := machine.LastPoppedStackElement().Inspect(); got != tt.expected {
+			t.Errorf("%s: want = %s, got = %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestCallbackBuiltinErrors checks a failure in a function a builtin calls is a runtime error pointing into it
+func TestCallbackBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string
+		expectedTrace []string
+	}{
+		{
+			"let inverse = fn(x) { 1 / x };\nlet f = fn() { map([1, 0], inverse) };\nf() + 1",
+			"1:25: division by zero",
+			[]string{"inverse", "f", MainFunctionName},
+		},
+		{
+			"map([1], fn(x, y) { x })",
+			"1:4: wrong number of arguments: want=2, got=1",
+			[]string{MainFunctionName},
+		},
+		{
+			"map([1, 2, 3], len)",
+			"1:4: argument to len not supported, got INTEGER",
+			[]string{MainFunctionName},
+		},
+	}
+
+	for _, tt := range tests {
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("%s: compiler error: %s", tt.input, err)
+		}
+
+		machine := New(myCompiler.ByteCode())
+
+		err = machine.Run()
+
+		var runtimeError *RuntimeError
+
+		if !errors.As(err, &runtimeError) {
+			t.Fatalf("%s: expected a *RuntimeError, got %T (%v)", tt.input, err, err)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want = %q, got = %q", tt.input, tt.expected, err.Error())
+		}
+
+		var functions []string
+
+		for _, frame := range runtimeError.StackTrace {
+			functions = append(functions, frame.Function)
+		}
+
+		if strings.Join(functions, " ") != strings.Join(tt.expectedTrace, " ") {
+			t.Errorf("%s: wrong stack trace. want = %v, got = %v", tt.input, tt.expectedTrace, functions)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	testTable := []vmTestCase{
 		{
@@ -803,3 +972,861 @@ func TestRecursiveFibonacci(t *testing.T) {
 	}
 	runVmTests(t, testTable)
 }
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	testTable := []vmTestCase{
+		{
+			input: `let index = fn(x) {
+	x[0]
+};
+index(1);`,
+			expected: "main.monkey:2:3: index operator not supported for : INTEGER",
+		},
+		{
+			input: `let hash = {};
+let key = fn() { 1 };
+hash[key];`,
+			expected: "main.monkey:3:5: unusable as a key: CLOSURE",
+		},
+		{
+			input:    `1 + "one"`,
+			expected: "main.monkey:1:3: unsupported types for binary operation: INTEGER STRING",
+		},
+		{
+			input:    `let x = 2 * 60; x + 10 / (5 - 5)`,
+			expected: "main.monkey:1:24: division by zero",
+		},
+	}
+
+	for _, tt := range testTable {
+		program := parser.New(lexer.NewWithFilename("main.monkey", tt.input)).ParseProgram()
+
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(myCompiler.ByteCode()).Run()
+
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		var runtimeError *RuntimeError
+
+		if !errors.As(err, &runtimeError) {
+			t.Fatalf("error is not a *RuntimeError. got = %T (%v)", err, err)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+	x[0]
+};
+let outer = fn() {
+	let wrap = fn() { inner(1) + 0 };
+	wrap() + 0
+};
+outer();`
+
+	program := parser.New(lexer.NewWithFilename("main.monkey", input)).ParseProgram()
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(program)
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(myCompiler.ByteCode()).Run()
+
+	var runtimeError *RuntimeError
+
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("error is not a *RuntimeError. got = %T (%v)", err, err)
+	}
+
+	expected := []struct {
+		function string
+		position string
+	}{
+		{"inner", "main.monkey:2:3"},
+		{"wrap", "main.monkey:5:25"},
+		{"outer", "main.monkey:6:6"},
+		{MainFunctionName, "main.monkey:8:6"},
+	}
+
+	if len(runtimeError.StackTrace) != len(expected) {
+		t.Fatalf("wrong stack trace length. want = %d, got = %d\n%s", len(expected), len(runtimeError.StackTrace), runtimeError.StackTrace)
+	}
+
+	for i, want := range expected {
+		frame := runtimeError.StackTrace[i]
+
+		if frame.Function != want.function {
+			t.Errorf("frame %d has wrong function. want = %q, got = %q", i, want.function, frame.Function)
+		}
+
+		if frame.Position.String() != want.position {
+			t.Errorf("frame %d has wrong position. want = %s, got = %s", i, want.position, frame.Position)
+		}
+	}
+
+	if runtimeError.StackTrace[0].Instruction != 5 {
+		t.Errorf("innermost frame has wrong instruction. want = %d, got = %d", 5, runtimeError.StackTrace[0].Instruction)
+	}
+}
+
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+
+	if !ok {
+		return fmt.Errorf("object is not *object.Float. got = %T (%v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value, got = %g , want = %g", result.Value, expected)
+	}
+
+	return nil
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	testTable := []vmTestCase{
+		{"1.5", 1.5},
+		{"1e-9", 1e-9},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"3 / 2.0", 1.5},
+		{"2.5 * 2", 5.0},
+		{"1 - 2.5", -1.5},
+		{"-2.5", -2.5},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+		{"float(3) / 2", 1.5},
+		{"int(2.9)", 2},
+		{`float("0.25")`, 0.25},
+		{`int("42")`, 42},
+		{`int("four")`, &object.Error{Message: `could not convert "four" to INTEGER`}},
+		{`float(true)`, &object.Error{Message: "argument to float not supported, got BOOLEAN"}},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	testTable := []vmTestCase{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"1 <= 0.5", false},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7.5 % 2", 1.5},
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"1 && 2", true},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"0 || false", true},
+		{"1 < 2 && 2 < 3", true},
+		{"let calls = fn() { 1 }; false && calls()", false},
+		{"let boom = fn() { 1 + true }; true || boom()", true},
+		{"let boom = fn() { 1 + true }; false && boom()", false},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestLoops(t *testing.T) {
+	testTable := []vmTestCase{
+		{`let f = fn(items) { for (x in items) { if (x > 2) { return x; } } }; f([1, 2, 3, 4])`, 3},
+		{`let f = fn() { for (k in {"b": 1, "a": 2}) { return k; } }; f()`, "a"},
+		{`let f = fn() { for (c in "monkey") { return c; } }; f()`, "m"},
+		{`let f = fn() { for (x in [1, 2, 3, 4]) { if (x < 3) { continue; } return x; } }; f()`, 3},
+		{`let f = fn() { for (x in [1, 2, 3]) { break; return x; }; 99 }; f()`, 99},
+		{`let f = fn() { for (x in [1, 2, 3]) { for (y in [4, 5, 6]) { if (y > 4) { break; } if (x > 1) { return x * y; } } } }; f()`, 8},
+		{`let f = fn() { while (true) { return 7; } }; f()`, 7},
+		{`let f = fn() { while (true) { break; }; 5 }; f()`, 5},
+		{`let f = fn() { for (x in []) { } }; f()`, Null},
+		{`for (x in [1, 2, 3]) { let y = x * 10; }; x + y`, 33},
+		// a branch ending with a loop, a let or nothing evaluates to null
+		{`if (true) { while (false) { } }; 1`, 1},
+		{`if (true) { while (false) { } }`, Null},
+		{`if (false) { 1 } else { for (x in [1]) { } }`, Null},
+		{`let f = fn(n) { if (n > 0) { let m = n; } else { } }; f(1)`, Null},
+		{`let f = fn(n) { if (n > 0) { } else { } }; f(1)`, Null},
+		{`let i = 0; while (i < 3) { if (i == 1) { while (false) { } }; i += 1 }; i`, 3},
+		// a loop leaves null, not its condition, evaluator.TestLoops has the same cases
+		{`for (x in [1]) { }`, Null},
+		{`while (false) { }`, Null},
+		{`let i = 0; while (i < 2) { i += 1 }`, Null},
+		{`while (true) { break; }`, Null},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestAssignments(t *testing.T) {
+	testTable := []vmTestCase{
+		{`let x = 1; x = 2; x`, 2},
+		{`let x = 1; x = x + 1`, 2},
+		{`let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x`, 6},
+		{`let x = 1.5; x *= 2; x`, 3.0},
+		{`let s = "mon"; s += "key"; s`, "monkey"},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let x = 1; let y = (x = 5) + 1; x * y`, 30},
+		{`let f = fn(x) { x += 1; x }; f(1)`, 2},
+		{`let count = 0; let inc = fn() { count += 1 }; inc(); inc(); count`, 2},
+		{`let f = fn() { let x = 1; let set = fn(v) { x = v }; set(7); x }; f()`, 7},
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()`, 3},
+		{`let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()`, 1},
+		{`let f = fn() { let x = 1; let get = fn() { x }; x = 2; get() }; f()`, 2},
+		{`let f = fn() { let x = 0; let g = fn() { fn() { x += 10 } }; g()(); g()(); x }; f()`, 20},
+		{`let i = 0; let sum = 0; while (i < 5) { sum += i; i += 1; }; sum`, 10},
+		{`let sum = 0; for (x in [1, 2, 3]) { sum += x; }; sum`, 6},
+		{`let f = fn() { let n = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } n += x; }; n }; f()`, 4},
+		{`let i = 0; while (true) { i += 1; if (i > 2) { break; } }; i`, 3},
+		{`let i = 0; while (i < 5000) { i += 1; }; i`, 5000},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestIndexAssignments(t *testing.T) {
+	testTable := []vmTestCase{
+		{`let a = [1, 2, 3]; a[1] = 5; a`, []int{1, 5, 3}},
+		{`let a = [1, 2, 3]; a[0] += 10; a[2] *= a[0]; a`, []int{11, 2, 33}},
+		{`let a = [1]; let b = a; b[0] = 2; a[0]`, 2},
+		{`let a = [0, 0]; let x = a[1] = 7; x + a[1]`, 14},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]`, 3},
+		{`let h = {"n": 1}; let calls = 0; let key = fn() { calls += 1; "n" }; h[key()] += 1; h["n"] * 10 + calls`, 21},
+		{`let fill = fn(a, v) { let i = 0; while (i < len(a)) { a[i] = v; i += 1; } }; let a = [1, 2, 3]; fill(a, 9); a`, []int{9, 9, 9}},
+		{`let counts = {}; for (c in "abca") { if (!counts[c]) { counts[c] = 0; } counts[c] += 1; }; counts["a"]`, 2},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	testTable := []vmTestCase{
+		{`let a = [1]; a[1] = 2`, "index out of range : 1 (length 1)"},
+		{`let a = [1]; a[-1] = 2`, "index out of range : -1 (length 1)"},
+		{`let a = [1]; a["x"] = 2`, "array index must be an INTEGER, got : STRING"},
+		{`let h = {}; h[[1]] = 2`, "unusable as a key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported for : STRING"},
+	}
+
+	for _, tt := range testTable {
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(myCompiler.ByteCode()).Run()
+
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		var runtimeError *RuntimeError
+
+		if !errors.As(err, &runtimeError) {
+			t.Fatalf("error is not a *RuntimeError. got = %T (%v)", err, err)
+		}
+
+		if runtimeError.Err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want = %q, got = %q", tt.expected, runtimeError.Err)
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	testTable := []vmTestCase{
+		{"2 * 60 * 60", 7200},
+		{`"mon" + "key"`, "monkey"},
+		{"-(1 + 2) * 3 % 4", -1},
+		{"!(1 < 2) == false", true},
+		{"false && 1 / 0 == 1", false},
+		{"let x = 3; x * (2 + 5)", 21},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestTailCalls(t *testing.T) {
+	testTable := []vmTestCase{
+		{
+			// far deeper than MaxFrames, every call reuses the frame of its caller
+			input: `
+				let sum = fn(n, acc) {
+					if (n == 0) { return acc; }
+					sum(n - 1, acc + n)
+				};
+				sum(100000, 0);
+				`,
+			expected: 5000050000,
+		},
+		{
+			input: `
+				let isEven = fn(n, even) { if (n == 0) { even } else { isEven(n - 1, !even) } };
+				isEven(50001, true);
+				`,
+			expected: false,
+		},
+		{
+			// the callee has more locals than the caller has slots
+			input: `
+				let inner = fn(a) { let b = a * 2; let c = b + 1; c };
+				let outer = fn() { inner(20) };
+				outer();
+				`,
+			expected: 41,
+		},
+		{
+			input: `
+				let outer = fn(x) {
+					let adder = fn(y) { x + y };
+					adder(2)
+				};
+				outer(40);
+				`,
+			expected: 42,
+		},
+		{
+			input:    `let f = fn(x) { len(x) }; f([1, 2, 3])`,
+			expected: 3,
+		},
+	}
+
+	runVmTests(t, testTable)
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	tableTests := []struct {
+		input   string
+		options Options
+	}{
+		// runs out of stack first
+		{"let f = fn(x) { 1 + f(x + 1) }; f(0)", Options{}},
+		// runs out of frames first
+		{"let f = fn(x) { 1 + f(x + 1) }; f(0)", Options{StackSize: 1 << 16}},
+		// the locals of the callee do not fit
+		{"let f = fn() { let a = 1; let b = 2; let c = 3; a + b + c }; f()", Options{StackSize: 3}},
+		{"let f = fn(x) { 1 + f(x + 1) }; f(0)", Options{MaxFrames: 10}},
+	}
+
+	for _, tt := range tableTests {
+		program := parse(tt.input)
+
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(program)
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = NewWithOptions(myCompiler.ByteCode(), tt.options).Run()
+
+		if !errors.Is(err, ErrMaxCallDepth) {
+			t.Fatalf("%q: wrong error. want = %q, got = %v", tt.input, ErrMaxCallDepth, err)
+		}
+
+		var runtimeError *RuntimeError
+
+		if !errors.As(err, &runtimeError) || len(runtimeError.StackTrace) == 0 {
+			t.Fatalf("%q: expected a runtime error with a stack trace. got = %v", tt.input, err)
+		}
+
+		if last := runtimeError.StackTrace[len(runtimeError.StackTrace)-1]; last.Function != MainFunctionName {
+			t.Errorf("%q: outermost frame is not the main program. got = %q", tt.input, last.Function)
+		}
+	}
+}
+
+func TestMaxCallDepthOptions(t *testing.T) {
+	input := "let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } }; f(1500)"
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(myCompiler.ByteCode()).Run()
+
+	if !errors.Is(err, ErrMaxCallDepth) {
+		t.Fatalf("wrong error with the default limits. want = %q, got = %v", ErrMaxCallDepth, err)
+	}
+
+	machine := NewWithOptions(myCompiler.ByteCode(), Options{StackSize: 1 << 14, MaxFrames: 2048})
+
+	err = machine.Run()
+
+	if err != nil {
+		t.Fatalf("vm error with larger limits: %s", err)
+	}
+
+	err = testIntegerObject(1500, machine.LastPoppedStackElement())
+
+	if err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+// TestTailCallOverflowKeepsCaller checks a tail call that does not fit fails before it overwrites the caller's frame
+func TestTailCallOverflowKeepsCaller(t *testing.T) {
+	var locals []string
+
+	for i := 0; i < 40; i++ {
+		locals = append(locals, fmt.Sprintf("let %s = %d;", strings.Repeat("a", i+1), i))
+	}
+
+	input := fmt.Sprintf("let big = fn(x) { %s x }; let outer = fn(y) { big(y + 1) }; outer(41)", strings.Join(locals, " "))
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := NewWithOptions(myCompiler.ByteCode(), Options{StackSize: 32})
+
+	err = machine.Run()
+
+	if !errors.Is(err, ErrMaxCallDepth) {
+		t.Fatalf("wrong error. want = %q, got = %v", ErrMaxCallDepth, err)
+	}
+
+	frame := machine.frames[machine.framesIndex-1]
+
+	if frame.closureFn.Fn.Name != "outer" {
+		t.Fatalf("wrong innermost frame. want = outer, got = %q", frame.closureFn.Fn.Name)
+	}
+
+	if machine.stack[frame.basePointer-1] != frame.closureFn {
+		t.Errorf("the callee slot of outer was overwritten with %v", machine.stack[frame.basePointer-1])
+	}
+
+	if err := testIntegerObject(41, machine.stack[frame.basePointer]); err != nil {
+		t.Errorf("the argument of outer was overwritten: %s", err)
+	}
+}
+
+func TestStackTraceString(t *testing.T) {
+	stackTrace := make(StackTrace, 25)
+
+	for i := range stackTrace {
+		stackTrace[i] = StackFrame{Function: fmt.Sprintf("f%d", i)}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stackTrace.String(), "\n"), "\n")
+
+	if len(lines) != 21 {
+		t.Fatalf("wrong number of lines. want = 21, got = %d\n%s", len(lines), stackTrace)
+	}
+
+	if lines[10] != "\t... 5 more frames" {
+		t.Errorf("wrong elision line. got = %q", lines[10])
+	}
+
+	if !strings.Contains(lines[20], "f24") {
+		t.Errorf("outermost frame is missing. got = %q", lines[20])
+	}
+}
+
+func TestGrowableStackAndFrames(t *testing.T) {
+	input := `let a = 1; let b = 2; let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } }; f(500)`
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := myCompiler.ByteCode()
+
+	if bytecode.NumberOfGlobals != 3 {
+		t.Fatalf("wrong number of globals. want = 3, got = %d", bytecode.NumberOfGlobals)
+	}
+
+	machine := New(bytecode)
+
+	if len(machine.stack) != initialStackSize || cap(machine.frames) != initialFrames || len(machine.globals) != 3 {
+		t.Fatalf("wrong initial sizes. stack = %d, frames = %d, globals = %d", len(machine.stack), cap(machine.frames), len(machine.globals))
+	}
+
+	err = machine.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	err = testIntegerObject(500, machine.LastPoppedStackElement())
+
+	if err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+
+	if len(machine.stack) <= initialStackSize || len(machine.stack) > StackSize {
+		t.Errorf("stack did not grow within its ceiling. got = %d", len(machine.stack))
+	}
+
+	if len(machine.frames) <= initialFrames || len(machine.frames) > MaxFrames {
+		t.Errorf("frames did not grow within their ceiling. got = %d", len(machine.frames))
+	}
+}
+
+func TestGlobalStoreGrows(t *testing.T) {
+	globals := []object.Object{}
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	for _, input := range []string{"let a = 40;", "let b = 2;", "a + b"} {
+		myCompiler := compiler.NewWithState(symbolTable, constants)
+
+		err := myCompiler.Compile(parse(input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := myCompiler.ByteCode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalStore(bytecode, globals)
+
+		err = machine.Run()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		globals = machine.Globals()
+
+		if len(globals) != bytecode.NumberOfGlobals {
+			t.Errorf("%q: wrong number of globals. want = %d, got = %d", input, bytecode.NumberOfGlobals, len(globals))
+		}
+
+		if input == "a + b" {
+			err = testIntegerObject(42, machine.LastPoppedStackElement())
+
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	}
+}
+
+func TestExecutionBudget(t *testing.T) {
+	tableTests := []struct {
+		input       string
+		options     Options
+		expectedErr error
+	}{
+		{"let f = fn() { f() }; f()", Options{MaxInstructions: 10000}, ErrBudgetExceeded},
+		{"while (true) { }", Options{Deadline: time.Now().Add(20 * time.Millisecond)}, ErrBudgetExceeded},
+		{"let i = 0; while (i < 10) { i += 1 }; i", Options{MaxInstructions: 200}, nil},
+		{"let i = 0; while (i < 10) { i += 1 }; i", Options{MaxInstructions: 50}, ErrBudgetExceeded},
+		{"1 + 2", Options{Deadline: time.Now().Add(time.Minute)}, nil},
+	}
+
+	for _, tt := range tableTests {
+		myCompiler := compiler.New()
+
+		err := myCompiler.Compile(parse(tt.input))
+
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = NewWithOptions(myCompiler.ByteCode(), tt.options).Run()
+
+		if tt.expectedErr == nil {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s", tt.input, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("%q: wrong error. want = %q, got = %v", tt.input, tt.expectedErr, err)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	input := `let spin = fn(n) { while (true) { n += 1 } }; let outer = fn() { spin(0) + 1 }; outer()`
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	machine := New(myCompiler.ByteCode())
+
+	err = machine.RunContext(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error. want = %q, got = %v", context.Canceled, err)
+	}
+
+	var runtimeError *RuntimeError
+
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("error is not a *RuntimeError. got = %T (%v)", err, err)
+	}
+
+	// the VM stays where it stopped
+	stackTrace := machine.StackTrace()
+
+	if len(stackTrace) != 3 || stackTrace[0].Function != "spin" || stackTrace[1].Function != "outer" {
+		t.Errorf("wrong stack trace after cancellation.\n%s", stackTrace)
+	}
+
+	if machine.StackTop() == nil {
+		t.Errorf("stack is empty after cancellation")
+	}
+
+	deadlineCtx, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+
+	err = New(myCompiler.ByteCode()).RunContext(deadlineCtx)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error. want = %q, got = %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	input := `let scale = 10; let mul = fn(x) { x * scale }; let fail = fn() { 1 / 0 };`
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := myCompiler.ByteCode()
+	machine := New(bytecode)
+
+	err = machine.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	mul := machine.Globals()[1]
+	fail := machine.Globals()[2]
+
+	result, err := machine.Call(mul, &object.Integer{Value: 4})
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if err := testIntegerObject(40, result); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+
+	_, err = machine.Call(fail)
+
+	var runtimeError *RuntimeError
+
+	if !errors.As(err, &runtimeError) || runtimeError.Err.Error() != "division by zero" {
+		t.Fatalf("wrong error. want = division by zero, got = %v", err)
+	}
+
+	if len(runtimeError.StackTrace) != 2 || runtimeError.StackTrace[0].Function != "fail" {
+		t.Errorf("wrong stack trace.\n%s", runtimeError.StackTrace)
+	}
+
+	// the failed call is unwound, the VM can be called again
+	if len(machine.StackTrace()) != 1 {
+		t.Errorf("frames left after a failed call.\n%s", machine.StackTrace())
+	}
+
+	result, err = machine.Call(object.GetBuiltinByName("len"), &object.String{Value: "four"})
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if err := testIntegerObject(4, result); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+// TestCallBudget checks MaxInstructions is spent again by every call, not by the run and the calls together
+func TestCallBudget(t *testing.T) {
+	input := `let i = 0; while (i < 10) { i += 1 }; let count = fn() { let n = 0; while (n < 10) { n += 1 }; n };
+		let spin = fn() { while (true) { } };`
+
+	myCompiler := compiler.New()
+
+	err := myCompiler.Compile(parse(input))
+
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// the run and each call execute about 120 instructions
+	machine := NewWithOptions(myCompiler.ByteCode(), Options{MaxInstructions: 150})
+
+	err = machine.Run()
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	count := machine.Globals()[1]
+
+	for i := 0; i < 2; i++ {
+		result, err := machine.Call(count)
+
+		if err != nil {
+			t.Fatalf("call %d: vm error: %s", i, err)
+		}
+
+		if err := testIntegerObject(10, result); err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	}
+
+	// a call still has a limit of its own
+	_, err = machine.Call(machine.Globals()[2])
+
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("wrong error. want = %q, got = %v", ErrBudgetExceeded, err)
+	}
+}
+
+// TestAssembledPrograms runs bytecode written by hand, down to the exact instructions
+func TestAssembledPrograms(t *testing.T) {
+	tableTests := []vmTestCase{
+		{
+			input: `
+				== constants ==
+				0: 21
+				== main ==
+				OpConstant 0
+				OpDup 1
+				OpAdd
+				OpPop
+			`,
+			expected: 42,
+		},
+		{
+			// a closure writes to its free variable, the cell VM.pushClosure wraps it in
+			input: `
+				== constants ==
+				0: 5
+				2: 7
+				== main ==
+				OpConstant 0
+				OpClosure 1 1
+				OpCall 0
+				OpPop
+				== constant 1: fn <anonymous>, 0 parameters, 0 locals ==
+				OpConstant 2
+				OpSetFree 0
+				OpGetFree 0
+				OpReturnValue
+			`,
+			expected: 7,
+		},
+		{
+			input: `
+				== constants ==
+				0: 3
+				1: 0
+				2: 1
+				== main ==
+				OpConstant 0
+				OpSetGlobal 0
+				loop:
+				OpGetGlobal 0
+				OpConstant 1
+				OpGreaterThan
+				OpJumpNotTruthy end
+				OpGetGlobal 0
+				OpConstant 2
+				OpSub
+				OpSetGlobal 0
+				OpJump loop
+				end:
+				OpGetGlobal 0
+				OpPop
+			`,
+			expected: 0,
+		},
+		{
+			// a tail call from the main program is a plain call
+			input: `
+				== main ==
+				OpClosure 0 0
+				OpTailCall 0
+				OpPop
+				== constant 0: fn f, 0 parameters, 0 locals ==
+				OpTrue
+				OpReturnValue
+			`,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tableTests {
+		bytecode, err := assembler.Assemble(tt.input)
+
+		if err != nil {
+			t.Fatalf("assembler error: %s", err)
+		}
+
+		machine := New(bytecode)
+
+		err = machine.Run()
+
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, machine.LastPoppedStackElement())
+	}
+}